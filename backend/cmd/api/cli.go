@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"picturebot-backend/internal/migrate"
+	"picturebot-backend/internal/service"
+
+	"gorm.io/gorm"
+)
+
+// runCheck implements the "check" subcommand. It prints the report as JSON and
+// exits non-zero when issues remain, so it can be scheduled and monitored.
+func runCheck(library *service.LibraryService, args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	hash := fs.Bool("hash", false, "compare file contents, reads every file")
+	repair := fs.Bool("repair", false, "apply the default repair to every issue found")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	report, err := library.Check(*hash)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "check failed:", err)
+		return 1
+	}
+
+	out := any(report)
+	if *repair && len(report.Issues) > 0 {
+		reqs := make([]service.RepairRequest, 0, len(report.Issues))
+		for _, issue := range report.Issues {
+			reqs = append(reqs, service.RepairRequest{
+				Type:        issue.Type,
+				Path:        issue.Path,
+				PictureID:   issue.PictureID,
+				SubFolderID: issue.SubFolderID,
+			})
+		}
+		out = map[string]any{"report": report, "repairs": library.Repair(reqs)}
+	}
+
+	if err := printJSON(out); err != nil {
+		return 1
+	}
+
+	if len(report.Issues) > 0 && !*repair {
+		return 3
+	}
+	return 0
+}
+
+// runRebuild implements the "rebuild" subcommand, which restores the catalog from the album
+// manifests after the database was lost. Albums already in the catalog are skipped.
+func runRebuild(library *service.LibraryService, args []string) int {
+	fs := flag.NewFlagSet("rebuild", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	report, err := library.Rebuild()
+	if report != nil {
+		printJSON(report)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rebuild failed:", err)
+		return 1
+	}
+	return 0
+}
+
+// runManifests implements the "manifests" subcommand, which rewrites every album manifest.
+func runManifests(library *service.LibraryService, args []string) int {
+	fs := flag.NewFlagSet("manifests", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	written, err := library.WriteManifests()
+	fmt.Printf("%d album manifests written\n", written)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "writing manifests failed:", err)
+		return 1
+	}
+	return 0
+}
+
+// runMigrations implements the "migrations" subcommand. It prints the applied and pending schema
+// migrations without changing the database; with -pending it lists only the pending ones and exits
+// non-zero when there are any.
+func runMigrations(db *gorm.DB, args []string) int {
+	fs := flag.NewFlagSet("migrations", flag.ContinueOnError)
+	pendingOnly := fs.Bool("pending", false, "only list migrations that have not run yet")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	statuses, err := migrate.List(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reading schema version failed:", err)
+		return 1
+	}
+
+	pending := 0
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			pending++
+		} else if *pendingOnly {
+			continue
+		}
+
+		state := "pending"
+		if s.AppliedAt != nil {
+			state = "applied " + s.AppliedAt.Format(time.DateTime)
+		}
+		fmt.Printf("%4d  %-40s %s\n", s.Version, s.Name, state)
+	}
+
+	current, err := migrate.Current(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reading schema version failed:", err)
+		return 1
+	}
+	fmt.Printf("schema version %d, this build migrates to %d, %d pending\n", current, migrate.Latest(), pending)
+
+	if current > migrate.Latest() {
+		fmt.Fprintln(os.Stderr, migrate.ErrSchemaTooNew)
+		return 1
+	}
+	if *pendingOnly && pending > 0 {
+		return 3
+	}
+	return 0
+}
+
+// runRestore implements the "restore" subcommand, which replaces the catalog database with a snapshot.
+// The server must be stopped. The snapshot is verified first and the current database is kept next to
+// it, so a restore can be undone; migrations the snapshot lacks run at the next start.
+func runRestore(db *gorm.DB, dbPath string, args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: restore <snapshot file>")
+		return 2
+	}
+	snapshot := fs.Arg(0)
+
+	version, err := migrate.VerifySnapshot(snapshot)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "snapshot rejected:", err)
+		return 1
+	}
+
+	keep := fmt.Sprintf("%s.pre-restore-%s.bak", dbPath, time.Now().Format("20060102-150405"))
+	if err := migrate.Snapshot(db, keep); err != nil {
+		fmt.Fprintln(os.Stderr, "saving the current database failed:", err)
+		return 1
+	}
+
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.Close()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "closing the database failed:", err)
+		return 1
+	}
+
+	// Copy next to the database first so the swap itself is a single rename
+	tmp := dbPath + ".restore"
+	if err := copyDatabase(snapshot, tmp); err != nil {
+		os.Remove(tmp)
+		fmt.Fprintln(os.Stderr, "copying the snapshot failed:", err)
+		return 1
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		os.Remove(tmp)
+		fmt.Fprintln(os.Stderr, "replacing the database failed, is the server still running?", err)
+		return 1
+	}
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		os.Remove(dbPath + suffix)
+	}
+
+	fmt.Printf("restored %s (schema version %d, current is %d)\n", snapshot, version, migrate.Latest())
+	fmt.Printf("the replaced database was saved as %s\n", keep)
+	return 0
+}
+
+func copyDatabase(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
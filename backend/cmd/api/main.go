@@ -1,13 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"time"
 
 	"picturebot-backend/internal/api"
-	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/events"
+	"picturebot-backend/internal/migrate"
 	"picturebot-backend/internal/repository"
 	"picturebot-backend/internal/service"
 
@@ -20,8 +22,10 @@ import (
 	"gorm.io/gorm"
 )
 
+const dbPath = "C:\\Users\\joost\\Documents\\Picturebot-Go\\dev.db"
+
 func main() {
-	db, err := gorm.Open(sqlite.Open("C:\\Users\\joost\\Documents\\Picturebot-Go\\dev.db"), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
 
 	if err != nil {
 		slog.Error("failed to connect database", "error", err)
@@ -55,13 +59,18 @@ func main() {
 
 	slog.SetDefault(slog.New(handler))
 
-	// Auto-migrate schema
-	if err := db.AutoMigrate(
-		&model.Picture{},
-		&model.SubFolder{},
-		&model.Hierarchy{},
-		&model.Settings{},
-	); err != nil {
+	// Commands on the database file itself run before the schema is migrated
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrations":
+			os.Exit(runMigrations(db, os.Args[2:]))
+		case "restore":
+			os.Exit(runRestore(db, dbPath, os.Args[2:]))
+		}
+	}
+
+	// Migrate schema
+	if _, err := migrate.Run(db, dbPath); err != nil {
 		slog.Error("failed to migrate", "error", err)
 		os.Exit(1)
 	}
@@ -70,22 +79,98 @@ func main() {
 	pictureRepo := repository.NewPictureRepository(db)
 	hierarchyRepo := repository.NewHierarchyRepository(db)
 	settingsRepo := repository.NewSettingsRepository(db)
+	subFolderRepo := repository.NewSubFolderRepository(db)
+	tagRepo := repository.NewTagRepository(db)
+	backupRepo := repository.NewBackupRepository(db)
 
 	// Initialize Services
-	pictureService := service.NewPictureService(pictureRepo)
-	hierarchyService := service.NewHierarchyService(hierarchyRepo, pictureRepo)
-	settingsService := service.NewSettingsService(settingsRepo)
+	broker := events.NewBroker()
+	pictureService := service.NewPictureService(pictureRepo, hierarchyRepo, broker)
+	hierarchyService := service.NewHierarchyService(hierarchyRepo, pictureRepo, subFolderRepo, settingsRepo, broker)
+	settingsService := service.NewSettingsService(settingsRepo, hierarchyRepo)
+	tagService := service.NewTagService(tagRepo, pictureRepo, hierarchyRepo, broker)
+	libraryService := service.NewLibraryService(hierarchyRepo, pictureRepo, subFolderRepo, tagRepo, broker)
+	scrubService := service.NewScrubService(pictureRepo, settingsRepo, broker)
+	hotFolderService := service.NewHotFolderService(hierarchyService, settingsRepo)
+	watcherService := service.NewWatcherService(libraryService, subFolderRepo, pictureRepo, settingsRepo, broker)
+	backupService := service.NewBackupService(backupRepo, settingsRepo, dbPath)
+	exportService := service.NewExportService(hierarchyRepo, broker)
+
+	// Subcommands run against the same database and exit instead of serving
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			os.Exit(runCheck(libraryService, os.Args[2:]))
+		case "rebuild":
+			os.Exit(runRebuild(libraryService, os.Args[2:]))
+		case "manifests":
+			os.Exit(runManifests(libraryService, os.Args[2:]))
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q, available: check, rebuild, manifests, migrations, restore\n", os.Args[1])
+			os.Exit(2)
+		}
+	}
+
+	// Background jobs
+	go scrubService.Run(context.Background())
+	go hotFolderService.Run(context.Background())
+	go backupService.Run(context.Background())
+	go func() {
+		if err := watcherService.Run(context.Background()); err != nil {
+			slog.Error("album watcher stopped", "error", err)
+		}
+	}()
 
 	// Initialize Router
 	router := gin.Default()
 
 	// Routes
 	router.GET("/pictures", api.GetPictures(pictureService))
+	router.GET("/pictures/search", api.SearchPictures(pictureService))
 	router.GET("/pictures/:id", api.FindByID(pictureService))
+	router.PATCH("/pictures/:id", api.UpdatePicture(pictureService))
 	router.GET("/pictures/hierarchy/:id", api.FindByHierarchyID(pictureService))
+	router.POST("/pictures/move", api.MovePictures(hierarchyService))
+	router.POST("/pictures/tag", api.TagPictures(tagService))
+	router.POST("/pictures/untag", api.UntagPictures(tagService))
 
 	router.POST("/hierarchy", api.CreateNode(hierarchyService))
 	router.GET("/hierarchy", api.GetHierarchy(hierarchyService))
+	router.GET("/hierarchy/tree", api.GetHierarchyTree(hierarchyService))
+	router.GET("/hierarchy/search", api.SearchAlbums(hierarchyService))
+	router.GET("/hierarchy/:id/children", api.GetChildren(hierarchyService))
+	router.GET("/hierarchy/:id/ancestors", api.GetAncestors(hierarchyService))
+	router.GET("/hierarchy/stats", api.GetAllStats(hierarchyService))
+	router.GET("/hierarchy/:id/stats", api.GetNodeStats(hierarchyService))
+	router.PATCH("/hierarchy/:id", api.UpdateNode(hierarchyService))
+	router.DELETE("/hierarchy/:id", api.DeleteNode(hierarchyService))
+	router.PUT("/hierarchy/:id/order", api.ReorderChildren(hierarchyService))
+	router.POST("/hierarchy/:id/merge", api.MergeAlbums(hierarchyService))
+	router.POST("/hierarchy/:id/split", api.SplitAlbum(hierarchyService))
+	router.POST("/hierarchy/:id/subfolders", api.AddSubFolder(hierarchyService))
+	router.PATCH("/hierarchy/:id/subfolders/:subFolderId", api.RenameSubFolder(hierarchyService))
+	router.DELETE("/hierarchy/:id/subfolders/:subFolderId", api.RemoveSubFolder(hierarchyService))
+	router.POST("/hierarchy/:id/export", api.ExportAlbum(exportService))
+
+	router.GET("/exports/:id", api.GetExport(exportService))
+	router.GET("/exports/:id/download", api.DownloadExport(exportService))
+
+	router.GET("/tags", api.GetTags(tagService))
+	router.GET("/tags/suggest", api.SuggestTags(tagService))
+	router.POST("/tags", api.CreateTag(tagService))
+	router.DELETE("/tags/:id", api.DeleteTag(tagService))
+
+	router.GET("/library/check", api.CheckLibrary(libraryService))
+	router.POST("/library/repair", api.RepairLibrary(libraryService))
+	router.POST("/library/manifests", api.WriteManifests(libraryService))
+	router.POST("/library/rebuild", api.RebuildLibrary(libraryService))
+	router.GET("/library/scrub", api.GetScrubReport(scrubService))
+	router.POST("/library/scrub", api.StartScrub(scrubService))
+
+	router.GET("/events", api.StreamEvents(broker))
+
+	router.POST("/admin/backup", api.CreateBackup(backupService))
+	router.GET("/admin/backups", api.ListBackups(backupService))
 
 	router.GET("/settings", api.GetSettings(settingsService))
 	router.POST("/settings", api.UpdateSettings(settingsService))
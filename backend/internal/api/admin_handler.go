@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+	"picturebot-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateBackup writes a snapshot of the catalog database now
+func CreateBackup(s *service.BackupService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		backup, err := s.Backup()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to back up database"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, backup)
+	}
+}
+
+// ListBackups returns the snapshots in the backup directory, newest first
+func ListBackups(s *service.BackupService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		backups, err := s.List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list backups"})
+			return
+		}
+
+		c.JSON(http.StatusOK, backups)
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"picturebot-backend/internal/events"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// keepaliveInterval keeps idle streams from being closed by proxies and lets clients notice dead connections
+const keepaliveInterval = 20 * time.Second
+
+// StreamEvents sends library changes to the client as server-sent events until it disconnects.
+// Clients reconnecting with a Last-Event-ID header receive the events they missed.
+func StreamEvents(b *events.Broker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var lastID uint64
+		if header := c.GetHeader("Last-Event-ID"); header != "" {
+			id, err := strconv.ParseUint(header, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+				return
+			}
+			lastID = id
+		}
+
+		ch, unsubscribe := b.Subscribe(lastID)
+		defer unsubscribe()
+
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		c.Header("Content-Type", "text/event-stream")
+
+		// Send the headers right away so the client sees the stream open before the first event
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		keepalive := time.NewTicker(keepaliveInterval)
+		defer keepalive.Stop()
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case <-keepalive.C:
+				// Comment lines are ignored by EventSource clients
+				_, err := io.WriteString(w, ": keepalive\n\n")
+				return err == nil
+			case ev, ok := <-ch:
+				if !ok {
+					return false
+				}
+				c.Render(-1, sse.Event{
+					Id:    strconv.FormatUint(ev.ID, 10),
+					Event: ev.Type,
+					Data:  ev,
+				})
+				return true
+			}
+		})
+	}
+}
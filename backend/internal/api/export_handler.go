@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"picturebot-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportAlbum answers with a ZIP archive of an album, or starts a background export with background=true
+func ExportAlbum(s *service.ExportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		albumID, ok := parseIDParam(c, "id", "ExportAlbum")
+		if !ok {
+			return
+		}
+
+		var req struct {
+			service.ExportRequest
+			Background bool `json:"background"`
+		}
+		// An empty body exports the whole album
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		plan, err := s.Plan(albumID, req.ExportRequest)
+		if err != nil {
+			writeAlbumOperationError(c, err, "Failed to export album")
+			return
+		}
+
+		if req.Background {
+			status, err := s.Start(plan)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start export"})
+				return
+			}
+			c.JSON(http.StatusAccepted, status)
+			return
+		}
+
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": plan.FileName}))
+		c.Status(http.StatusOK)
+
+		// The status is sent already, a failure can only cut the archive short
+		if err := s.Write(c.Request.Context(), plan, c.Writer); err != nil {
+			slog.Warn("API: Album export aborted", "id", albumID, "error", err)
+		}
+	}
+}
+
+// GetExport returns the progress of a background export
+func GetExport(s *service.ExportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, err := s.Status(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// DownloadExport sends the archive of a finished background export
+func DownloadExport(s *service.ExportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path, name, err := s.Archive(c.Param("id"))
+		if err != nil {
+			if errors.Is(err, service.ErrExportRunning) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.FileAttachment(path, name)
+	}
+}
@@ -1,9 +1,12 @@
 package api
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
 	"picturebot-backend/internal/model"
 	"picturebot-backend/internal/service"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,10 +16,12 @@ func CreateNode(s *service.HierarchyService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
 			ParentID   uint              `json:"parent_id"`
-			Name       string            `json:"name" binding:"required"`
-			Type       string            `json:"type" binding:"required"`
+			Name       string            `json:"name"`
+			Type       string            `json:"type"`
 			SubFolders []model.SubFolder `json:"sub_folders"`
 			SourcePath string            `json:"source_path"`
+			Query      string            `json:"query"`
+			Template   string            `json:"template"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -31,13 +36,15 @@ func CreateNode(s *service.HierarchyService) gin.HandlerFunc {
 			Type:       model.HierarchyType(req.Type),
 			SubFolders: req.SubFolders,
 			SourcePath: req.SourcePath,
+			Query:      req.Query,
+			Template:   req.Template,
 		}
 
 		node, err := s.CreateNode(serviceReq)
 		if err != nil {
-			// Check if it's a "duplicate" error to send 409 Conflict
-			if err.Error() == "a folder with this name already exists here" {
-				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			var verr *service.ValidationError
+			if errors.As(err, &verr) {
+				writeValidationError(c, verr)
 				return
 			}
 
@@ -49,6 +56,222 @@ func CreateNode(s *service.HierarchyService) gin.HandlerFunc {
 	}
 }
 
+// UpdateNode renames and/or moves a Folder or Album
+func UpdateNode(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			slog.Warn("API: Invalid ID format in UpdateNode", "input", idStr, "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		var req service.UpdateNodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		node, err := s.UpdateNode(uint(id), req)
+		if err != nil {
+			var verr *service.ValidationError
+			switch {
+			case errors.As(err, &verr):
+				writeValidationError(c, verr)
+			case errors.Is(err, service.ErrNodeNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update node"})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, node)
+	}
+}
+
+// ReorderChildren stores a manual order for the children of a folder; use id 0 for the root level
+func ReorderChildren(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			slog.Warn("API: Invalid ID format in ReorderChildren", "input", idStr, "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		var req struct {
+			ChildIDs []uint `json:"child_ids" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		children, err := s.ReorderChildren(uint(id), req.ChildIDs)
+		if err != nil {
+			var verr *service.ValidationError
+			switch {
+			case errors.As(err, &verr):
+				writeValidationError(c, verr)
+			case errors.Is(err, service.ErrNodeNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder nodes"})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, children)
+	}
+}
+
+// DeleteNode removes a node and its descendants. Pass preview=true to only get the counts
+// and trash=true to move the album directories into the library trash. Without trash the directories
+// stay in the library and are listed in the result.
+func DeleteNode(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			slog.Warn("API: Invalid ID format in DeleteNode", "input", idStr, "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		preview := c.Query("preview") == "true"
+		trash := c.Query("trash") == "true"
+
+		result, err := s.DeleteNode(uint(id), preview, trash)
+		if err != nil {
+			if errors.Is(err, service.ErrNodeNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+
+			if result != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "result": result})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete node"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// MergeAlbums moves every picture of the source album into the album in the URL and removes the source
+func MergeAlbums(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			slog.Warn("API: Invalid ID format in MergeAlbums", "input", idStr, "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		var req struct {
+			SourceID uint `json:"source_id" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		album, err := s.MergeAlbums(uint(id), req.SourceID)
+		if err != nil {
+			writeAlbumOperationError(c, err, "Failed to merge albums")
+			return
+		}
+
+		c.JSON(http.StatusOK, album)
+	}
+}
+
+// SplitAlbum divides an album by calendar day, by time gap or by an explicit picture selection
+func SplitAlbum(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			slog.Warn("API: Invalid ID format in SplitAlbum", "input", idStr, "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		var req service.SplitAlbumRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		albums, err := s.SplitAlbum(uint(id), req)
+		if err != nil {
+			writeAlbumOperationError(c, err, "Failed to split album")
+			return
+		}
+
+		c.JSON(http.StatusOK, albums)
+	}
+}
+
+// MovePictures moves pictures, together with their RAW/JPG partners, into another album
+func MovePictures(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			PictureIDs []uint `json:"picture_ids" binding:"required"`
+			TargetID   uint   `json:"target_id" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		album, err := s.MovePictures(req.TargetID, req.PictureIDs)
+		if err != nil {
+			writeAlbumOperationError(c, err, "Failed to move pictures")
+			return
+		}
+
+		c.JSON(http.StatusOK, album)
+	}
+}
+
+// writeValidationError answers with the rejected fields, using 409 Conflict when only names collided.
+func writeValidationError(c *gin.Context, verr *service.ValidationError) {
+	status := http.StatusBadRequest
+	if verr.Conflict() {
+		status = http.StatusConflict
+	}
+
+	c.JSON(status, gin.H{"error": "Validation failed", "fields": verr.Fields})
+}
+
+// writeAlbumOperationError maps the album operation errors onto HTTP status codes.
+func writeAlbumOperationError(c *gin.Context, err error, fallback string) {
+	var verr *service.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		writeValidationError(c, verr)
+	case errors.Is(err, service.ErrNodeNotFound), errors.Is(err, service.ErrPictureNotFound), errors.Is(err, service.ErrSubFolderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidUpdate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrDuplicateName):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
 // GetHierarchy returns the whole folder structure nested
 func GetHierarchy(s *service.HierarchyService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -62,3 +285,127 @@ func GetHierarchy(s *service.HierarchyService) gin.HandlerFunc {
 		c.JSON(http.StatusOK, tree)
 	}
 }
+
+// GetHierarchyTree returns the whole structure with picture counts instead of embedded pictures
+func GetHierarchyTree(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tree, err := s.GetTree()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build hierarchy"})
+			return
+		}
+
+		c.JSON(http.StatusOK, tree)
+	}
+}
+
+// GetChildren returns one level below a node for lazy loading; use id 0 for the root level
+func GetChildren(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			slog.Warn("API: Invalid ID format in GetChildren", "input", idStr, "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		children, err := s.GetChildren(uint(id))
+		if err != nil {
+			if errors.Is(err, service.ErrNodeNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch children"})
+			return
+		}
+
+		c.JSON(http.StatusOK, children)
+	}
+}
+
+// GetAncestors returns the breadcrumb trail from the root down to a node
+func GetAncestors(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			slog.Warn("API: Invalid ID format in GetAncestors", "input", idStr, "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		trail, err := s.GetAncestors(uint(id))
+		if err != nil {
+			if errors.Is(err, service.ErrNodeNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ancestors"})
+			return
+		}
+
+		c.JSON(http.StatusOK, trail)
+	}
+}
+
+// GetNodeStats returns aggregate picture stats for an album, smart album or folder
+func GetNodeStats(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			slog.Warn("API: Invalid ID format in GetNodeStats", "input", idStr, "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		stats, err := s.GetNodeStats(uint(id))
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrNodeNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, service.ErrInvalidQuery):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute stats"})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, stats)
+	}
+}
+
+// GetAllStats returns the stats of every node keyed by id for dashboards
+func GetAllStats(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := s.GetAllStats()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute stats"})
+			return
+		}
+
+		c.JSON(http.StatusOK, stats)
+	}
+}
+
+// SearchAlbums finds albums by their details or pictures using the search language in q
+func SearchAlbums(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		albums, err := s.SearchAlbums(c.Query("q"))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidQuery) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search albums"})
+			return
+		}
+
+		c.JSON(http.StatusOK, albums)
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"picturebot-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckLibrary compares the catalog with the disk; hash=true also compares file contents
+func CheckLibrary(s *service.LibraryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := s.Check(c.Query("hash") == "true")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check library"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// RepairLibrary applies repair actions to issues from a previous check
+func RepairLibrary(s *service.LibraryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Repairs []service.RepairRequest `json:"repairs" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, s.Repair(req.Repairs))
+	}
+}
+
+// WriteManifests rewrites the manifest file in every album directory
+func WriteManifests(s *service.LibraryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		written, err := s.WriteManifests()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write album manifests", "written": written})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"written": written})
+	}
+}
+
+// RebuildLibrary restores albums missing from the catalog from their manifest files
+func RebuildLibrary(s *service.LibraryService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := s.Rebuild()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rebuild library", "report": report})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GetScrubReport returns the integrity scrubber's progress and the pictures that failed verification
+func GetScrubReport(s *service.ScrubService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := s.Report()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load scrub report"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// StartScrub starts a scrub pass now; all=true verifies every picture instead of only the due ones
+func StartScrub(s *service.ScrubService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := s.Start(c.Query("all") == "true"); err != nil {
+			if errors.Is(err, service.ErrScrubRunning) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start scrub"})
+			return
+		}
+
+		c.Status(http.StatusAccepted)
+	}
+}
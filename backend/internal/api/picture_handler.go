@@ -1,23 +1,40 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/repository"
 	"picturebot-backend/internal/service"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 func GetPictures(s *service.PictureService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		pictures, err := s.GetPictures()
+		q, err := parsePictureQuery(c)
 		if err != nil {
+			slog.Warn("API: Invalid picture listing parameters", "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pictures, total, err := s.GetPictures(q)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidQuery) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pictures"})
 			return
 		}
-		c.JSON(http.StatusOK, pictures)
+
+		writePictureList(c, pictures, total, q)
 	}
 }
 
@@ -40,6 +57,30 @@ func FindByID(s *service.PictureService) gin.HandlerFunc {
 	}
 }
 
+// UpdatePicture sets the rating and/or pick flag of a picture
+func UpdatePicture(s *service.PictureService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseIDParam(c, "id", "UpdatePicture")
+		if !ok {
+			return
+		}
+
+		var req service.UpdatePictureRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		picture, err := s.UpdatePicture(id, req)
+		if err != nil {
+			writeAlbumOperationError(c, err, "Failed to update picture")
+			return
+		}
+
+		c.JSON(http.StatusOK, picture)
+	}
+}
+
 func FindByHierarchyID(s *service.PictureService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idStr := c.Param("id")
@@ -50,13 +91,50 @@ func FindByHierarchyID(s *service.PictureService) gin.HandlerFunc {
 			return
 		}
 
-		pictures, err := s.FindByHierarchyID(uint(id))
+		q, err := parsePictureQuery(c)
+		if err != nil {
+			slog.Warn("API: Invalid picture listing parameters", "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pictures, total, err := s.FindByHierarchyID(uint(id), q)
 		if err != nil {
+			if errors.Is(err, service.ErrInvalidQuery) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch node pictures"})
 			return
 		}
 
-		c.JSON(http.StatusOK, pictures)
+		writePictureList(c, pictures, total, q)
+	}
+}
+
+// SearchPictures runs a search language query passed in the q parameter across the whole library
+func SearchPictures(s *service.PictureService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, err := parsePictureQuery(c)
+		if err != nil {
+			slog.Warn("API: Invalid picture listing parameters", "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pictures, total, err := s.Search(c.Query("q"), q)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidQuery) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search pictures"})
+			return
+		}
+
+		writePictureList(c, pictures, total, q)
 	}
 }
 
@@ -76,3 +154,80 @@ func CreatePicture(s *service.PictureService) gin.HandlerFunc {
 		c.JSON(http.StatusCreated, req)
 	}
 }
+
+// parsePictureQuery reads the limit, offset, sort, order and fields query parameters.
+func parsePictureQuery(c *gin.Context) (repository.PictureQuery, error) {
+	var q repository.PictureQuery
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return q, errors.New("invalid limit")
+		}
+		q.Limit = limit
+	}
+
+	if v := c.Query("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil {
+			return q, errors.New("invalid offset")
+		}
+		q.Offset = offset
+	}
+
+	q.Sort = c.Query("sort")
+
+	switch strings.ToLower(c.DefaultQuery("order", "asc")) {
+	case "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, errors.New("order must be asc or desc")
+	}
+
+	if v := c.Query("fields"); v != "" {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				q.Fields = append(q.Fields, f)
+			}
+		}
+	}
+
+	return q, nil
+}
+
+// writePictureList sends a page of pictures with the total match count in the X-Total-Count header.
+// When a field projection is requested only those keys are included for each picture.
+func writePictureList(c *gin.Context, pictures []model.Picture, total int64, q repository.PictureQuery) {
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+
+	if len(q.Fields) == 0 {
+		c.JSON(http.StatusOK, pictures)
+		return
+	}
+
+	projected := make([]gin.H, 0, len(pictures))
+	for _, p := range pictures {
+		raw, err := json.Marshal(p)
+		if err != nil {
+			slog.Error("API: Failed to encode picture", "id", p.ID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode pictures"})
+			return
+		}
+
+		var full map[string]any
+		if err := json.Unmarshal(raw, &full); err != nil {
+			slog.Error("API: Failed to encode picture", "id", p.ID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode pictures"})
+			return
+		}
+
+		row := gin.H{}
+		for _, f := range q.Fields {
+			row[f] = full[f]
+		}
+		projected = append(projected, row)
+	}
+
+	c.JSON(http.StatusOK, projected)
+}
@@ -1,9 +1,9 @@
 package api
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
-	"picturebot-backend/internal/model"
 	"picturebot-backend/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -25,22 +25,29 @@ func GetSettings(s *service.SettingsService) gin.HandlerFunc {
 
 func UpdateSettings(s *service.SettingsService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req model.Settings
+		var req service.UpdateSettingsRequest
 
-		// Bind JSON to struct
+		// Bind JSON to struct, settings left out keep their stored value
 		if err := c.ShouldBindJSON(&req); err != nil {
 			slog.Warn("API: Invalid settings update request", "error", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 			return
 		}
 
-		if err := s.UpdateSettings(&req); err != nil {
+		settings, err := s.UpdateSettings(req)
+		if err != nil {
+			var verr *service.ValidationError
+			if errors.As(err, &verr) {
+				writeValidationError(c, verr)
+				return
+			}
+
 			slog.Error("API: Failed to save settings to database", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
 			return
 		}
 
 		slog.Info("API: Settings updated successfully")
-		c.JSON(http.StatusOK, req)
+		c.JSON(http.StatusOK, settings)
 	}
 }
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"picturebot-backend/internal/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type subFolderRequest struct {
+	Name string `json:"name"`
+}
+
+// AddSubFolder creates a subfolder and its directory in an album
+func AddSubFolder(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		albumID, ok := parseIDParam(c, "id", "AddSubFolder")
+		if !ok {
+			return
+		}
+
+		var req subFolderRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sub, err := s.AddSubFolder(albumID, req.Name)
+		if err != nil {
+			writeAlbumOperationError(c, err, "Failed to add subfolder")
+			return
+		}
+
+		c.JSON(http.StatusCreated, sub)
+	}
+}
+
+// RenameSubFolder renames a subfolder together with its directory and picture locations
+func RenameSubFolder(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		albumID, ok := parseIDParam(c, "id", "RenameSubFolder")
+		if !ok {
+			return
+		}
+		subFolderID, ok := parseIDParam(c, "subFolderId", "RenameSubFolder")
+		if !ok {
+			return
+		}
+
+		var req subFolderRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sub, err := s.RenameSubFolder(albumID, subFolderID, req.Name)
+		if err != nil {
+			writeAlbumOperationError(c, err, "Failed to rename subfolder")
+			return
+		}
+
+		c.JSON(http.StatusOK, sub)
+	}
+}
+
+// RemoveSubFolder deletes an empty subfolder and its directory
+func RemoveSubFolder(s *service.HierarchyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		albumID, ok := parseIDParam(c, "id", "RemoveSubFolder")
+		if !ok {
+			return
+		}
+		subFolderID, ok := parseIDParam(c, "subFolderId", "RemoveSubFolder")
+		if !ok {
+			return
+		}
+
+		if err := s.RemoveSubFolder(albumID, subFolderID); err != nil {
+			writeAlbumOperationError(c, err, "Failed to remove subfolder")
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// parseIDParam reads a numeric path parameter and answers 400 when it is malformed.
+func parseIDParam(c *gin.Context, name, handler string) (uint, bool) {
+	idStr := c.Param(name)
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		slog.Warn("API: Invalid ID format in "+handler, "input", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return 0, false
+	}
+	return uint(id), true
+}
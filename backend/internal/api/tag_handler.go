@@ -0,0 +1,146 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"picturebot-backend/internal/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTags returns the keyword tree with picture counts
+func GetTags(s *service.TagService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tags, err := s.GetTree()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+			return
+		}
+
+		c.JSON(http.StatusOK, tags)
+	}
+}
+
+// CreateTag creates a tag from a path such as "People/Bride", adding missing parents
+func CreateTag(s *service.TagService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Path string `json:"path"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tag, err := s.CreateTag(req.Path)
+		if err != nil {
+			var verr *service.ValidationError
+			if errors.As(err, &verr) {
+				writeValidationError(c, verr)
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tag"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, tag)
+	}
+}
+
+// DeleteTag removes a tag, the tags below it and their assignments
+func DeleteTag(s *service.TagService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			slog.Warn("API: Invalid ID format in DeleteTag", "input", idStr, "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		deleted, err := s.DeleteTag(uint(id))
+		if err != nil {
+			if errors.Is(err, service.ErrTagNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+	}
+}
+
+// SuggestTags autocompletes tags for the text in q, limited by limit
+func SuggestTags(s *service.TagService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 0
+		if raw := c.Query("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+				return
+			}
+			limit = n
+		}
+
+		tags, err := s.Suggest(c.Query("q"), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suggest tags"})
+			return
+		}
+
+		c.JSON(http.StatusOK, tags)
+	}
+}
+
+// TagPictures adds tags to pictures in bulk
+func TagPictures(s *service.TagService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req service.TagRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := s.TagPictures(req)
+		writeTagResult(c, result, err, "Failed to tag pictures")
+	}
+}
+
+// UntagPictures removes tags from pictures in bulk
+func UntagPictures(s *service.TagService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req service.TagRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := s.UntagPictures(req)
+		writeTagResult(c, result, err, "Failed to untag pictures")
+	}
+}
+
+func writeTagResult(c *gin.Context, result *service.TagResult, err error, fallback string) {
+	if err != nil {
+		var verr *service.ValidationError
+		if errors.As(err, &verr) {
+			writeValidationError(c, verr)
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,122 @@
+// Package events fans out change notifications from the service layer to connected clients.
+package events
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Event types. Data is the affected model, or a small struct where no model fits.
+const (
+	NodeCreated = "node.created" // A folder or album was created
+	NodeUpdated = "node.updated" // A node's details, position, subfolders or pictures changed
+	NodeDeleted = "node.deleted" // A node and everything below it was deleted
+
+	PictureAdded    = "picture.added"    // A file appeared in an album and was imported
+	PictureUpdated  = "picture.updated"  // A file's content, rating or flag changed
+	PictureMissing  = "picture.missing"  // A file was deleted outside the app
+	PictureRenamed  = "picture.renamed"  // A file was renamed or moved within its album
+	PicturesUpdated = "pictures.updated" // Tags were added to or removed from pictures in bulk
+
+	TagCreated = "tag.created"
+	TagDeleted = "tag.deleted"
+
+	JobProgress = "job.progress" // A long running job started, advanced or finished
+
+	// Resync tells a reconnecting client that events were lost and it should reload its state
+	Resync = "resync"
+)
+
+const (
+	subscriberBuffer = 64  // How many events a slow client may fall behind before it misses events
+	historySize      = 256 // Recent events kept for clients that reconnect with Last-Event-ID
+)
+
+type Event struct {
+	ID   uint64    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+// Broker delivers every published event to all current subscribers.
+type Broker struct {
+	mu          sync.Mutex
+	nextID      uint64
+	subscribers map[chan Event]struct{}
+	history     []Event // The last historySize events, oldest first
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[chan Event]struct{})}
+}
+
+// Publish sends an event to every subscriber without blocking. Subscribers whose buffer is full miss it.
+// A nil broker discards events, so services can publish without checking whether streaming is set up.
+func (b *Broker) Publish(eventType string, data any) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	ev := Event{ID: b.nextID, Type: eventType, Time: time.Now(), Data: data}
+
+	if len(b.history) == historySize {
+		b.history = append(b.history[:0], b.history[1:]...)
+	}
+	b.history = append(b.history, ev)
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			slog.Warn("Event dropped for slow subscriber", "type", eventType, "id", ev.ID)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every event published from now on and a function that ends the subscription.
+// A lastID above zero first replays the events published after it. When those are no longer all kept, or lastID
+// is from before a restart, a single Resync event is sent instead.
+func (b *Broker) Subscribe(lastID uint64) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer+historySize)
+
+	b.mu.Lock()
+	if lastID > 0 {
+		b.replay(ch, lastID)
+	}
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// replay queues the events after lastID on ch. The caller holds b.mu.
+func (b *Broker) replay(ch chan Event, lastID uint64) {
+	if lastID == b.nextID {
+		return
+	}
+
+	complete := lastID < b.nextID && (len(b.history) == 0 || b.history[0].ID <= lastID+1)
+	if !complete {
+		ch <- Event{ID: b.nextID, Type: Resync, Time: time.Now()}
+		return
+	}
+
+	for _, ev := range b.history {
+		if ev.ID > lastID {
+			ch <- ev
+		}
+	}
+}
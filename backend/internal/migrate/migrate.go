@@ -0,0 +1,154 @@
+// Package migrate brings the catalog database schema up to date with ordered, versioned migrations.
+//
+// Every migration runs in its own transaction together with the row that records it in the
+// schema_migrations table, so a failed migration leaves the database at the previous version.
+// Before anything is applied to a database that already holds data, a snapshot of it is written
+// next to the database file.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration changes the schema from Version-1 to Version. Up runs inside a transaction.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+}
+
+// Status describes one known migration and whether the database has it.
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+var ErrSchemaTooNew = errors.New("database schema is newer than this build")
+
+// schemaMigration is a row of the schema version table.
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Latest returns the schema version this build migrates to.
+func Latest() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Current returns the highest applied version, 0 for a database that was never migrated.
+func Current(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		return 0, nil
+	}
+
+	var version int
+	err := db.Model(&schemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// List returns every known migration with the time it was applied, in version order.
+func List(db *gorm.DB) ([]Status, error) {
+	applied := make(map[int]time.Time)
+	if db.Migrator().HasTable(&schemaMigration{}) {
+		var rows []schemaMigration
+		if err := db.Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			applied[r.Version] = r.AppliedAt
+		}
+	}
+
+	statuses := make([]Status, 0, len(migrations))
+	for _, m := range migrations {
+		s := Status{Version: m.Version, Name: m.Name}
+		if at, ok := applied[m.Version]; ok {
+			s.AppliedAt = &at
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations the database does not have yet.
+func Pending(db *gorm.DB) ([]Migration, error) {
+	current, err := Current(db)
+	if err != nil {
+		return nil, err
+	}
+	if current > Latest() {
+		return nil, fmt.Errorf("%w: version %d, this build knows up to %d", ErrSchemaTooNew, current, Latest())
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Run applies the pending migrations. When the database already holds tables it is first
+// snapshotted to dbPath plus a version and time suffix. It returns how many migrations ran.
+func Run(db *gorm.DB, dbPath string) (int, error) {
+	pending, err := Pending(db)
+	if err != nil || len(pending) == 0 {
+		return 0, err
+	}
+
+	current, err := Current(db)
+	if err != nil {
+		return 0, err
+	}
+
+	tables, err := db.Migrator().GetTables()
+	if err != nil {
+		return 0, err
+	}
+	if len(tables) > 0 {
+		backup := fmt.Sprintf("%s.v%d-%s.bak", dbPath, current, time.Now().Format("20060102-150405"))
+		if err := Snapshot(db, backup); err != nil {
+			slog.Error("IO error: failed to back up database before migrating", "path", backup, "error", err)
+			return 0, fmt.Errorf("backup before migrating failed: %w", err)
+		}
+		slog.Info("Database backed up before migrating", "path", backup, "version", current)
+	}
+
+	return apply(db, pending)
+}
+
+// apply runs the given migrations in order, each in its own transaction.
+func apply(db *gorm.DB, pending []Migration) (int, error) {
+	if err := db.Exec("CREATE TABLE IF NOT EXISTS `schema_migrations` (`version` integer PRIMARY KEY,`name` text NOT NULL,`applied_at` datetime NOT NULL)").Error; err != nil {
+		return 0, err
+	}
+
+	for i, m := range pending {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			slog.Error("Database migration failed", "version", m.Version, "name", m.Name, "error", err)
+			return i, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		slog.Info("Database migrated", "version", m.Version, "name", m.Name)
+	}
+
+	return len(pending), nil
+}
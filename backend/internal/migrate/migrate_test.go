@@ -0,0 +1,141 @@
+package migrate
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// autoMigrateSchema is the schema AutoMigrate created for the catalog before versioned migrations.
+var autoMigrateSchema = []string{
+	"CREATE TABLE `hierarchies` (`id` integer PRIMARY KEY AUTOINCREMENT,`parent_id` integer,`type` text NOT NULL,`name` text NOT NULL,`uuid` char(36))",
+	"CREATE INDEX `idx_hierarchies_uuid` ON `hierarchies`(`uuid`)",
+	"CREATE INDEX `idx_hierarchies_parent_id` ON `hierarchies`(`parent_id`)",
+	"CREATE TABLE `sub_folders` (`id` integer PRIMARY KEY AUTOINCREMENT,`name` text,`location` text,`hierarchy_id` integer NOT NULL,CONSTRAINT `fk_hierarchies_sub_folders` FOREIGN KEY (`hierarchy_id`) REFERENCES `hierarchies`(`id`))",
+	"CREATE INDEX `idx_sub_folders_hierarchy_id` ON `sub_folders`(`hierarchy_id`)",
+	"CREATE TABLE `pictures` (`id` integer PRIMARY KEY AUTOINCREMENT,`file_name` text NOT NULL,`index` text,`extension` text,`type` text,`location` text,`sub_folder_id` integer NOT NULL,CONSTRAINT `fk_sub_folders_pictures` FOREIGN KEY (`sub_folder_id`) REFERENCES `sub_folders`(`id`))",
+	"CREATE INDEX `idx_pictures_sub_folder_id` ON `pictures`(`sub_folder_id`)",
+	"CREATE INDEX `idx_pictures_type` ON `pictures`(`type`)",
+	"CREATE TABLE `settings` (`id` integer PRIMARY KEY AUTOINCREMENT,`theme_mode` text DEFAULT \"system\",`library_path` text DEFAULT \"\")",
+
+	"INSERT INTO `hierarchies` (`id`,`parent_id`,`type`,`name`,`uuid`) VALUES (1,NULL,'folder','2024',''),(2,1,'album','Wedding','0b7d3c52-5d1e-4a8e-9a57-4f5d2f8f0c11')",
+	"INSERT INTO `sub_folders` (`id`,`name`,`location`,`hierarchy_id`) VALUES (1,'RAWs','/library/0b7d3c52/RAWs',2)",
+	"INSERT INTO `pictures` (`id`,`file_name`,`index`,`extension`,`type`,`location`,`sub_folder_id`) VALUES (1,'Wedding_000001.ARW','000001','.ARW','RAW','/library/0b7d3c52/RAWs/Wedding_000001.ARW',1)",
+	"INSERT INTO `settings` (`id`,`theme_mode`,`library_path`) VALUES (1,'dark','/library')",
+}
+
+func openTestDB(t *testing.T, name string) (*gorm.DB, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db, path
+}
+
+// columns returns the sorted column names of every table. Added columns sit at the end of a
+// table, so only the set of columns is compared.
+func columns(t *testing.T, db *gorm.DB) map[string][]string {
+	t.Helper()
+
+	tables, err := db.Migrator().GetTables()
+	if err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+
+	result := make(map[string][]string)
+	for _, table := range tables {
+		var names []string
+		if err := db.Raw("SELECT name FROM pragma_table_info(?) ORDER BY cid", table).Scan(&names).Error; err != nil {
+			t.Fatalf("columns of %s: %v", table, err)
+		}
+		sort.Strings(names)
+		result[table] = names
+	}
+	return result
+}
+
+func TestRunUpgradesAutoMigrateDatabase(t *testing.T) {
+	db, path := openTestDB(t, "legacy.db")
+	if err := execAll(db, autoMigrateSchema...); err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+
+	applied, err := Run(db, path)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if applied != len(migrations) {
+		t.Errorf("applied %d migrations, want %d", applied, len(migrations))
+	}
+	if version, _ := Current(db); version != Latest() {
+		t.Errorf("version %d after Run, want %d", version, Latest())
+	}
+
+	backups, _ := filepath.Glob(path + ".v0-*.bak")
+	if len(backups) != 1 {
+		t.Errorf("found %d backups before migrating, want 1", len(backups))
+	}
+
+	// The existing rows survive and the added columns carry their defaults
+	var album struct {
+		Name     string
+		Position int
+		Client   *string
+	}
+	if err := db.Raw("SELECT name, position, client FROM hierarchies WHERE id = 2").Scan(&album).Error; err != nil {
+		t.Fatalf("read album: %v", err)
+	}
+	if album.Name != "Wedding" || album.Position != 0 || album.Client != nil {
+		t.Errorf("album after upgrade = %+v", album)
+	}
+
+	var settings struct {
+		ThemeMode         string
+		RootSortMode      string
+		ScrubIntervalDays int
+		BackupKeep        int
+	}
+	if err := db.Raw("SELECT theme_mode, root_sort_mode, scrub_interval_days, backup_keep FROM settings WHERE id = 1").Scan(&settings).Error; err != nil {
+		t.Fatalf("read settings: %v", err)
+	}
+	if settings.ThemeMode != "dark" || settings.RootSortMode != "name" || settings.ScrubIntervalDays != 30 || settings.BackupKeep != 7 {
+		t.Errorf("settings after upgrade = %+v", settings)
+	}
+
+	// An upgraded database ends up with the same columns as a new one
+	fresh, freshPath := openTestDB(t, "fresh.db")
+	if _, err := Run(fresh, freshPath); err != nil {
+		t.Fatalf("Run on a new database: %v", err)
+	}
+	if got, want := columns(t, db), columns(t, fresh); !reflect.DeepEqual(got, want) {
+		t.Errorf("upgraded columns differ from a new database\n got: %v\nwant: %v", got, want)
+	}
+}
+
+func TestRunIsIdempotent(t *testing.T) {
+	db, path := openTestDB(t, "catalog.db")
+	if _, err := Run(db, path); err != nil {
+		t.Fatalf("first Run: %v", err)
+	}
+
+	applied, err := Run(db, path)
+	if err != nil {
+		t.Fatalf("second Run: %v", err)
+	}
+	if applied != 0 {
+		t.Errorf("second Run applied %d migrations, want 0", applied)
+	}
+}
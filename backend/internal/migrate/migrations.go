@@ -0,0 +1,138 @@
+package migrate
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// migrations lists every schema change in version order. Versions must be consecutive and a
+// migration must never change once released; fix mistakes with a new migration instead.
+var migrations = []Migration{
+	{Version: 1, Name: "baseline schema", Up: baseline},
+	{Version: 2, Name: "backup settings", Up: backupSettings},
+}
+
+// baseline creates the schema as it stood when the catalog still used AutoMigrate. Databases from
+// those versions already have some of the tables, often with fewer columns, so tables are only
+// created when missing, missing columns are added, and the indexes come last.
+func baseline(tx *gorm.DB) error {
+	err := execAll(tx,
+		"CREATE TABLE IF NOT EXISTS `hierarchies` (`id` integer PRIMARY KEY AUTOINCREMENT,`parent_id` integer,`type` text NOT NULL,`name` text NOT NULL,`uuid` char(36),`query` text,`position` integer DEFAULT 0,`sort_mode` text,`created_at` datetime,`cover_picture_id` integer,`description` text,`event_start` datetime,`event_end` datetime,`location` text,`client` text,`contact` text)",
+		"CREATE TABLE IF NOT EXISTS `sub_folders` (`id` integer PRIMARY KEY AUTOINCREMENT,`name` text,`location` text,`hierarchy_id` integer NOT NULL,CONSTRAINT `fk_hierarchies_sub_folders` FOREIGN KEY (`hierarchy_id`) REFERENCES `hierarchies`(`id`))",
+		"CREATE TABLE IF NOT EXISTS `pictures` (`id` integer PRIMARY KEY AUTOINCREMENT,`file_name` text NOT NULL,`index` text,`extension` text,`type` text,`location` text,`rating` integer DEFAULT 0,`captured_at` datetime,`size` integer DEFAULT 0,`hash` text,`flag` text,`verified_at` datetime,`corrupted_at` datetime,`corruption` text,`missing_at` datetime,`sub_folder_id` integer NOT NULL,CONSTRAINT `fk_sub_folders_pictures` FOREIGN KEY (`sub_folder_id`) REFERENCES `sub_folders`(`id`))",
+		"CREATE TABLE IF NOT EXISTS `tags` (`id` integer PRIMARY KEY AUTOINCREMENT,`parent_id` integer,`name` text NOT NULL,`path` text NOT NULL,`created_at` datetime)",
+		"CREATE TABLE IF NOT EXISTS `picture_tags` (`picture_id` integer,`tag_id` integer,PRIMARY KEY (`picture_id`,`tag_id`),CONSTRAINT `fk_picture_tags_picture` FOREIGN KEY (`picture_id`) REFERENCES `pictures`(`id`),CONSTRAINT `fk_picture_tags_tag` FOREIGN KEY (`tag_id`) REFERENCES `tags`(`id`))",
+		"CREATE TABLE IF NOT EXISTS `picture_metadata` (`id` integer PRIMARY KEY AUTOINCREMENT,`picture_id` integer NOT NULL,`camera` text,`lens` text,`iso` integer,`aperture` real,`shutter_speed` text,`focal_length` real,CONSTRAINT `fk_pictures_metadata` FOREIGN KEY (`picture_id`) REFERENCES `pictures`(`id`))",
+		"CREATE TABLE IF NOT EXISTS `album_attributes` (`id` integer PRIMARY KEY AUTOINCREMENT,`hierarchy_id` integer NOT NULL,`key` text NOT NULL,`value` text,CONSTRAINT `fk_hierarchies_attributes` FOREIGN KEY (`hierarchy_id`) REFERENCES `hierarchies`(`id`))",
+		"CREATE TABLE IF NOT EXISTS `settings` (`id` integer PRIMARY KEY AUTOINCREMENT,`theme_mode` text DEFAULT \"system\",`library_path` text DEFAULT \"\",`root_sort_mode` text DEFAULT \"name\",`sub_folder_templates` text,`default_template` text DEFAULT \"\",`scrub_interval_days` integer DEFAULT 30,`scrub_rate_mb` integer DEFAULT 20,`watch_albums` numeric DEFAULT false,`hot_folders` text)",
+	)
+	if err != nil {
+		return err
+	}
+
+	// Columns the AutoMigrate versions added one by one. None of them is NOT NULL without a
+	// default, so SQLite can add them to a table that already holds rows.
+	err = addMissingColumns(tx,
+		column{"hierarchies", "query", "text"},
+		column{"hierarchies", "position", "integer DEFAULT 0"},
+		column{"hierarchies", "sort_mode", "text"},
+		column{"hierarchies", "created_at", "datetime"},
+		column{"hierarchies", "cover_picture_id", "integer"},
+		column{"hierarchies", "description", "text"},
+		column{"hierarchies", "event_start", "datetime"},
+		column{"hierarchies", "event_end", "datetime"},
+		column{"hierarchies", "location", "text"},
+		column{"hierarchies", "client", "text"},
+		column{"hierarchies", "contact", "text"},
+
+		column{"pictures", "rating", "integer DEFAULT 0"},
+		column{"pictures", "captured_at", "datetime"},
+		column{"pictures", "size", "integer DEFAULT 0"},
+		column{"pictures", "hash", "text"},
+		column{"pictures", "flag", "text"},
+		column{"pictures", "verified_at", "datetime"},
+		column{"pictures", "corrupted_at", "datetime"},
+		column{"pictures", "corruption", "text"},
+		column{"pictures", "missing_at", "datetime"},
+
+		column{"settings", "root_sort_mode", "text DEFAULT \"name\""},
+		column{"settings", "sub_folder_templates", "text"},
+		column{"settings", "default_template", "text DEFAULT \"\""},
+		column{"settings", "scrub_interval_days", "integer DEFAULT 30"},
+		column{"settings", "scrub_rate_mb", "integer DEFAULT 20"},
+		column{"settings", "watch_albums", "numeric DEFAULT false"},
+		column{"settings", "hot_folders", "text"},
+	)
+	if err != nil {
+		return err
+	}
+
+	return execAll(tx,
+		"CREATE INDEX IF NOT EXISTS `idx_hierarchies_client` ON `hierarchies`(`client`)",
+		"CREATE INDEX IF NOT EXISTS `idx_hierarchies_uuid` ON `hierarchies`(`uuid`)",
+		"CREATE INDEX IF NOT EXISTS `idx_hierarchies_parent_id` ON `hierarchies`(`parent_id`)",
+
+		"CREATE INDEX IF NOT EXISTS `idx_sub_folders_hierarchy_id` ON `sub_folders`(`hierarchy_id`)",
+
+		"CREATE INDEX IF NOT EXISTS `idx_pictures_sub_folder_id` ON `pictures`(`sub_folder_id`)",
+		"CREATE INDEX IF NOT EXISTS `idx_pictures_missing_at` ON `pictures`(`missing_at`)",
+		"CREATE INDEX IF NOT EXISTS `idx_pictures_corrupted_at` ON `pictures`(`corrupted_at`)",
+		"CREATE INDEX IF NOT EXISTS `idx_pictures_verified_at` ON `pictures`(`verified_at`)",
+		"CREATE INDEX IF NOT EXISTS `idx_pictures_flag` ON `pictures`(`flag`)",
+		"CREATE INDEX IF NOT EXISTS `idx_pictures_hash` ON `pictures`(`hash`)",
+		"CREATE INDEX IF NOT EXISTS `idx_pictures_captured_at` ON `pictures`(`captured_at`)",
+		"CREATE INDEX IF NOT EXISTS `idx_pictures_rating` ON `pictures`(`rating`)",
+		"CREATE INDEX IF NOT EXISTS `idx_pictures_type` ON `pictures`(`type`)",
+
+		"CREATE UNIQUE INDEX IF NOT EXISTS `idx_tags_path` ON `tags`(`path`)",
+		"CREATE INDEX IF NOT EXISTS `idx_tags_parent_id` ON `tags`(`parent_id`)",
+
+		"CREATE INDEX IF NOT EXISTS `idx_picture_metadata_iso` ON `picture_metadata`(`iso`)",
+		"CREATE INDEX IF NOT EXISTS `idx_picture_metadata_camera` ON `picture_metadata`(`camera`)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS `idx_picture_metadata_picture_id` ON `picture_metadata`(`picture_id`)",
+
+		"CREATE UNIQUE INDEX IF NOT EXISTS `idx_album_attribute_key` ON `album_attributes`(`hierarchy_id`,`key`)",
+	)
+}
+
+// backupSettings adds the snapshot directory, interval and retention to the settings.
+func backupSettings(tx *gorm.DB) error {
+	return execAll(tx,
+		"ALTER TABLE `settings` ADD COLUMN `backup_dir` text DEFAULT \"\"",
+		"ALTER TABLE `settings` ADD COLUMN `backup_interval_hours` integer DEFAULT 24",
+		"ALTER TABLE `settings` ADD COLUMN `backup_keep` integer DEFAULT 7",
+	)
+}
+
+// execAll runs the statements in order and stops at the first error.
+func execAll(tx *gorm.DB, statements ...string) error {
+	for _, stmt := range statements {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// column is a column added to an existing table; definition is everything after the name.
+type column struct {
+	table, name, definition string
+}
+
+// addMissingColumns adds each column its table does not have yet.
+func addMissingColumns(tx *gorm.DB, columns ...column) error {
+	for _, c := range columns {
+		var count int
+		if err := tx.Raw("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.name).Scan(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := tx.Exec(fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", c.table, c.name, c.definition)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var ErrInvalidSnapshot = errors.New("not a usable catalog snapshot")
+
+// Snapshot writes a consistent copy of the database to dest while it stays in use.
+// dest must not exist yet.
+func Snapshot(db *gorm.DB, dest string) error {
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+	return db.Exec("VACUUM INTO ?", dest).Error
+}
+
+// VerifySnapshot checks that the file at path is an intact catalog database this build can
+// migrate, and returns its schema version. Snapshots from before versioned migrations report 0.
+// Older snapshots are migrated on a temporary copy, so a restore never swaps in a database
+// that would fail at the next start.
+func VerifySnapshot(path string) (int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if info.IsDir() {
+		return 0, fmt.Errorf("%w: %s is a directory", ErrInvalidSnapshot, path)
+	}
+
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		return 0, err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	var result string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("%w: integrity check reported %s", ErrInvalidSnapshot, result)
+	}
+
+	if !db.Migrator().HasTable("pictures") || !db.Migrator().HasTable("hierarchies") {
+		return 0, fmt.Errorf("%w: the catalog tables are missing", ErrInvalidSnapshot)
+	}
+
+	version, err := Current(db)
+	if err != nil {
+		return 0, err
+	}
+	if version > Latest() {
+		return version, fmt.Errorf("%w: version %d, this build knows up to %d", ErrSchemaTooNew, version, Latest())
+	}
+
+	if version < Latest() {
+		if err := tryMigrate(db); err != nil {
+			return version, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+	}
+
+	return version, nil
+}
+
+// tryMigrate applies the pending migrations to a temporary copy of db and discards it.
+func tryMigrate(db *gorm.DB) error {
+	dir, err := os.MkdirTemp("", "picturebot-verify-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "snapshot.db")
+	if err := Snapshot(db, path); err != nil {
+		return err
+	}
+
+	trial, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		return err
+	}
+	if sqlDB, err := trial.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	pending, err := Pending(trial)
+	if err != nil {
+		return err
+	}
+	_, err = apply(trial, pending)
+	return err
+}
@@ -0,0 +1,39 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifySnapshotMigratesACopy(t *testing.T) {
+	db, path := openTestDB(t, "legacy.db")
+	if err := execAll(db, autoMigrateSchema...); err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+
+	version, err := VerifySnapshot(path)
+	if err != nil {
+		t.Fatalf("VerifySnapshot: %v", err)
+	}
+	if version != 0 {
+		t.Errorf("version %d, want 0", version)
+	}
+
+	// The snapshot itself is left as it was
+	if current, _ := Current(db); current != 0 {
+		t.Errorf("snapshot was migrated to version %d", current)
+	}
+}
+
+func TestVerifySnapshotRejectsUnmigratableSchema(t *testing.T) {
+	db, path := openTestDB(t, "broken.db")
+	// A tags table without the path column makes the baseline index fail
+	statements := append(autoMigrateSchema, "CREATE TABLE `tags` (`id` integer PRIMARY KEY AUTOINCREMENT,`name` text NOT NULL)")
+	if err := execAll(db, statements...); err != nil {
+		t.Fatalf("create broken schema: %v", err)
+	}
+
+	if _, err := VerifySnapshot(path); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("VerifySnapshot error = %v, want ErrInvalidSnapshot", err)
+	}
+}
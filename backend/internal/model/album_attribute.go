@@ -0,0 +1,9 @@
+package model
+
+// AlbumAttribute is a free-form key/value pair attached to an album, such as a venue or an order number.
+type AlbumAttribute struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"-"`
+	HierarchyID uint   `gorm:"not null;uniqueIndex:idx_album_attribute_key" json:"-"`
+	Key         string `gorm:"size:100;not null;uniqueIndex:idx_album_attribute_key" json:"key"`
+	Value       string `gorm:"type:text" json:"value"`
+}
@@ -1,10 +1,23 @@
 package model
 
+import "time"
+
 type HierarchyType string
 
 const (
 	TypeFolder HierarchyType = "folder"
 	TypeAlbum  HierarchyType = "album"
+	TypeSmart  HierarchyType = "smart" // Saved search, its pictures are resolved from Query on every read
+)
+
+// SortMode decides how the children of a folder are ordered.
+type SortMode string
+
+const (
+	SortManual       SortMode = "manual"        // By Position, set through the reorder endpoint
+	SortName         SortMode = "name"          // Alphabetically, the default
+	SortCreated      SortMode = "created"       // By CreatedAt, oldest first
+	SortFirstPicture SortMode = "first_picture" // By the earliest capture time below the node
 )
 
 type Hierarchy struct {
@@ -13,6 +26,23 @@ type Hierarchy struct {
 	Type       HierarchyType `gorm:"size:20;not null" json:"type"`
 	Name       string        `gorm:"size:255;not null" json:"name"`
 	UUID       string        `gorm:"type:char(36);index" json:"uuid,omitempty"`
+	Query      string        `gorm:"type:text" json:"query,omitempty"`
+	Position   int           `gorm:"default:0" json:"position"`
+	SortMode   SortMode      `gorm:"size:20" json:"sort_mode,omitempty"` // Only used by folders, empty means SortName
+	CreatedAt  time.Time     `json:"created_at"`
 	Children   []*Hierarchy  `gorm:"-" json:"children"`
 	SubFolders []SubFolder   `gorm:"foreignKey:HierarchyID" json:"sub_folders,omitempty"`
+
+	// Only used by albums. Trees report the effective cover, which falls back to the
+	// highest-rated picture when none was chosen or the chosen one left the album.
+	CoverPictureID *uint `json:"cover_picture_id"`
+
+	// Album details, used to organise deliveries by client and event
+	Description string           `gorm:"type:text" json:"description,omitempty"`
+	EventStart  *time.Time       `json:"event_start,omitempty"`
+	EventEnd    *time.Time       `json:"event_end,omitempty"`
+	Location    string           `gorm:"size:255" json:"location,omitempty"`
+	Client      string           `gorm:"size:255;index" json:"client,omitempty"`
+	Contact     string           `gorm:"size:255" json:"contact,omitempty"`
+	Attributes  []AlbumAttribute `gorm:"foreignKey:HierarchyID" json:"attributes,omitempty"`
 }
@@ -0,0 +1,17 @@
+package model
+
+// HierarchySummary is a lightweight view of a node that reports counts instead of embedding subfolders and pictures.
+type HierarchySummary struct {
+	ID           uint                `json:"id"`
+	ParentID     *uint               `json:"parent_id"`
+	Type         HierarchyType       `json:"type"`
+	Name         string              `json:"name"`
+	UUID         string              `json:"uuid,omitempty"`
+	Query        string              `json:"query,omitempty"`
+	Position     int                 `json:"position"`
+	SortMode     SortMode            `json:"sort_mode,omitempty"`
+	CoverPicture *uint               `json:"cover_picture_id,omitempty"`
+	ChildCount   int                 `json:"child_count"`
+	PictureCount int64               `json:"picture_count"` // Folders count every picture in the albums below them
+	Children     []*HierarchySummary `json:"children,omitempty"`
+}
@@ -1,12 +1,40 @@
 package model
 
+import "time"
+
+// Pick flags mark the culling decision for a picture; an empty flag means undecided.
+const (
+	FlagPick   = "pick"
+	FlagReject = "reject"
+)
+
 type Picture struct {
-	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
-	FileName  string `gorm:"not null" json:"file_name"`
-	Index     string `json:"index"`
-	Extension string `json:"extension"`
-	Type      string `gorm:"index" json:"type"`
-	Location  string `json:"location"`
+	ID         uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileName   string     `gorm:"not null" json:"file_name"`
+	Index      string     `json:"index"`
+	Extension  string     `json:"extension"`
+	Type       string     `gorm:"index" json:"type"`
+	Location   string     `json:"location"`
+	Rating     int        `gorm:"default:0;index" json:"rating"`
+	CapturedAt *time.Time `gorm:"index" json:"captured_at"`
+	Size       int64      `gorm:"default:0" json:"size"`
+	Hash       string     `gorm:"size:64;index" json:"hash,omitempty"` // SHA-256 of the file, hex encoded
+	Flag       string     `gorm:"size:10;index" json:"flag,omitempty"`
+
+	// Integrity scrubbing. VerifiedAt is the last time the file was re-read, CorruptedAt is
+	// set while it fails verification and Corruption describes what was wrong.
+	VerifiedAt  *time.Time `gorm:"index" json:"verified_at,omitempty"`
+	CorruptedAt *time.Time `gorm:"index" json:"corrupted_at,omitempty"`
+	Corruption  string     `gorm:"size:255" json:"corruption,omitempty"`
+
+	// Set by the album watcher when the file was deleted outside the app
+	MissingAt *time.Time `gorm:"index" json:"missing_at,omitempty"`
+
+	// Has One Relation (EXIF data, absent when the file carried none)
+	Metadata *PictureMetadata `gorm:"foreignKey:PictureID" json:"metadata,omitempty"`
+
+	// Many To Many Relation (keywords, only loaded for single pictures)
+	Tags []Tag `gorm:"many2many:picture_tags" json:"tags,omitempty"`
 
 	// Foreign Key: Links to subfolder
 	SubFolderID uint      `gorm:"not null;index" json:"sub_folder_id"`
@@ -0,0 +1,13 @@
+package model
+
+// PictureMetadata holds the camera settings read from a picture's EXIF data.
+type PictureMetadata struct {
+	ID           uint    `gorm:"primaryKey;autoIncrement" json:"-"`
+	PictureID    uint    `gorm:"not null;uniqueIndex" json:"-"`
+	Camera       string  `gorm:"index" json:"camera"` // e.g. "ILCE-7M4"
+	Lens         string  `json:"lens"`
+	ISO          int     `gorm:"index" json:"iso"`
+	Aperture     float64 `json:"aperture"`      // f-number, e.g. 2.8
+	ShutterSpeed string  `json:"shutter_speed"` // e.g. "1/250"
+	FocalLength  float64 `json:"focal_length"`  // in millimetres
+}
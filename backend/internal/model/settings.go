@@ -1,7 +1,56 @@
 package model
 
 type Settings struct {
-	ID          uint   `gorm:"primaryKey" json:"-"`
-	ThemeMode   string `gorm:"default:'system'" json:"theme_mode"`
-	LibraryPath string `gorm:"default:''" json:"library_path"`
+	ID           uint     `gorm:"primaryKey" json:"-"`
+	ThemeMode    string   `gorm:"default:'system'" json:"theme_mode"`
+	LibraryPath  string   `gorm:"default:''" json:"library_path"`
+	RootSortMode SortMode `gorm:"size:20;default:'name'" json:"root_sort_mode"` // Ordering of the top level nodes
+
+	// Subfolder layouts offered when creating an album. Albums use DefaultTemplate unless
+	// another one is chosen, and RAWs/JPGs when no template is configured at all.
+	SubFolderTemplates []SubFolderTemplate `gorm:"type:text;serializer:json" json:"sub_folder_templates"`
+	DefaultTemplate    string              `gorm:"size:100;default:''" json:"default_template"`
+
+	// Integrity scrubbing re-reads every picture once per interval, 0 days turns scheduled scrubbing off.
+	// The read rate is capped so the archive drive stays usable, 0 uses the default rate.
+	ScrubIntervalDays int `gorm:"default:30" json:"scrub_interval_days"`
+	ScrubRateMB       int `gorm:"default:20" json:"scrub_rate_mb"` // Megabytes per second
+
+	// Watch the subfolder directories of every album and register files added, changed,
+	// renamed or deleted by other programs, e.g. edits exported from a RAW developer.
+	WatchAlbums bool `gorm:"default:false" json:"watch_albums"`
+
+	// Inbox directories whose files are imported automatically, e.g. from a tethered camera
+	HotFolders []HotFolder `gorm:"type:text;serializer:json" json:"hot_folders"`
+
+	// Snapshots of the catalog database. An empty directory uses "backups" next to the database,
+	// 0 hours turns scheduled snapshots off and 0 kept snapshots keeps all of them.
+	BackupDir           string `gorm:"default:''" json:"backup_dir"`
+	BackupIntervalHours int    `gorm:"default:24" json:"backup_interval_hours"`
+	BackupKeep          int    `gorm:"default:7" json:"backup_keep"`
+}
+
+// SubFolderTemplate is a named list of subfolders, e.g. "Wedding": RAWs, JPGs, Edited, Exports, Video.
+type SubFolderTemplate struct {
+	Name    string   `json:"name"`
+	Folders []string `json:"folders"`
+}
+
+// Hot folder modes decide which album a settled file is imported into.
+const (
+	HotFolderRolling = "rolling" // The album named by the rule for the file's time, created when missing
+	HotFolderSession = "session" // The current session's album; a pause longer than the gap starts a new one
+)
+
+// HotFolder maps an inbox directory to the folder node its albums are created in.
+// Imported files are moved to .imported inside the inbox, or deleted with DeleteImported.
+type HotFolder struct {
+	Path           string `json:"path"`
+	FolderID       uint   `json:"folder_id"`       // Destination folder, 0 for the root
+	NameRule       string `json:"name_rule"`       // Album name with {date}, {year}, {month}, {day} and {time} placeholders
+	Mode           string `json:"mode"`            // HotFolderRolling or HotFolderSession, empty means rolling
+	GapMinutes     int    `json:"gap_minutes"`     // Session mode only, 0 uses the default
+	SettleSeconds  int    `json:"settle_seconds"`  // How long a file must stay unchanged before it is imported, 0 uses the default
+	Template       string `json:"template"`        // Subfolder template of new albums, empty uses the default
+	DeleteImported bool   `json:"delete_imported"` // Remove files from the inbox once they are imported
 }
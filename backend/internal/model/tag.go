@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// TagSeparator splits a tag path such as "Places/Belgium/Ghent" into its levels.
+const TagSeparator = "/"
+
+// Tag is a keyword in the hierarchical keyword tree. Path repeats the names of every
+// ancestor so a whole branch can be matched with a prefix.
+type Tag struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ParentID  *uint     `gorm:"index" json:"parent_id"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Path      string    `gorm:"size:1000;not null;uniqueIndex" json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Filled by the tag tree endpoint
+	PictureCount int64  `gorm:"->;-:migration" json:"picture_count"` // Pictures tagged with exactly this tag
+	TotalCount   int64  `gorm:"-" json:"total_count"`                // Pictures tagged with this tag or one below it
+	Children     []*Tag `gorm:"-" json:"children,omitempty"`
+}
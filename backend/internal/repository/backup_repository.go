@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"picturebot-backend/internal/migrate"
+
+	"gorm.io/gorm"
+)
+
+// BackupRepository takes snapshots of the catalog database itself.
+type BackupRepository struct {
+	db *gorm.DB
+}
+
+func NewBackupRepository(db *gorm.DB) *BackupRepository {
+	return &BackupRepository{db: db}
+}
+
+// Snapshot writes a consistent copy of the database to dest without blocking other connections.
+func (r *BackupRepository) Snapshot(dest string) error {
+	return migrate.Snapshot(r.db, dest)
+}
+
+// SchemaVersion returns the migration version of the database.
+func (r *BackupRepository) SchemaVersion() (int, error) {
+	return migrate.Current(r.db)
+}
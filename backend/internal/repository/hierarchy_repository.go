@@ -2,8 +2,10 @@ package repository
 
 import (
 	"picturebot-backend/internal/model"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type HierarchyRepository struct {
@@ -18,21 +20,350 @@ func (r *HierarchyRepository) Create(node *model.Hierarchy) error {
 	return r.db.Create(node).Error
 }
 
+func (r *HierarchyRepository) FindByID(id uint) (*model.Hierarchy, error) {
+	var node model.Hierarchy
+	err := r.db.First(&node, id).Error
+
+	return &node, err
+}
+
+// FindByUUID returns the album stored in the directory with the given UUID.
+func (r *HierarchyRepository) FindByUUID(id string) (*model.Hierarchy, error) {
+	var node model.Hierarchy
+	err := r.db.Where("uuid = ?", id).First(&node).Error
+
+	return &node, err
+}
+
+// FindByIDWithPictures loads a node together with its subfolders and their pictures.
+func (r *HierarchyRepository) FindByIDWithPictures(id uint) (*model.Hierarchy, error) {
+	var node model.Hierarchy
+	err := r.db.
+		Preload("SubFolders").
+		Preload("SubFolders.Pictures").
+		First(&node, id).Error
+
+	return &node, err
+}
+
+// FindWithContents loads an album with everything its manifest records: subfolders,
+// pictures with their metadata and tags, and attributes.
+func (r *HierarchyRepository) FindWithContents(id uint) (*model.Hierarchy, error) {
+	var node model.Hierarchy
+	err := r.db.
+		Preload("SubFolders", func(db *gorm.DB) *gorm.DB { return db.Order("name ASC") }).
+		Preload("SubFolders.Pictures", func(db *gorm.DB) *gorm.DB { return db.Order("file_name ASC") }).
+		Preload("SubFolders.Pictures.Metadata").
+		Preload("SubFolders.Pictures.Tags").
+		Preload("Attributes", func(db *gorm.DB) *gorm.DB { return db.Order("key ASC") }).
+		First(&node, id).Error
+
+	return &node, err
+}
+
 func (r *HierarchyRepository) FindAll() ([]*model.Hierarchy, error) {
 	var nodes []*model.Hierarchy
 	err := r.db.
 		Preload("SubFolders").
 		Preload("SubFolders.Pictures").
+		Preload("Attributes", func(db *gorm.DB) *gorm.DB { return db.Order("key ASC") }).
 		Order("name ASC").
 		Find(&nodes).Error
 
 	return nodes, err
 }
 
-func (r *HierarchyRepository) FindDuplicate(parentID *uint, name string, nodeType model.HierarchyType) (bool, error) {
+// Update persists a node's name, place in the tree and child sort mode.
+func (r *HierarchyRepository) Update(node *model.Hierarchy) error {
+	return updateNode(r.db, node)
+}
+
+func updateNode(db *gorm.DB, node *model.Hierarchy) error {
+	return db.Model(node).
+		Select("name", "parent_id", "position", "sort_mode", "cover_picture_id",
+			"description", "event_start", "event_end", "location", "client", "contact").
+		Updates(node).Error
+}
+
+// UpdateWithAttributes saves a node and applies attribute changes in one transaction.
+// Keys in set are created or overwritten, keys in remove are deleted.
+func (r *HierarchyRepository) UpdateWithAttributes(node *model.Hierarchy, set map[string]string, remove []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := updateNode(tx, node); err != nil {
+			return err
+		}
+
+		if len(remove) > 0 {
+			if err := tx.Where("hierarchy_id = ? AND key IN ?", node.ID, remove).Delete(&model.AlbumAttribute{}).Error; err != nil {
+				return err
+			}
+		}
+
+		for key, value := range set {
+			attr := model.AlbumAttribute{HierarchyID: node.ID, Key: key, Value: value}
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "hierarchy_id"}, {Name: "key"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value"}),
+			}).Create(&attr).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// FindAttributes returns the attributes of a node ordered by key.
+func (r *HierarchyRepository) FindAttributes(id uint) ([]model.AlbumAttribute, error) {
+	var attrs []model.AlbumAttribute
+	err := r.db.Where("hierarchy_id = ?", id).Order("key ASC").Find(&attrs).Error
+
+	return attrs, err
+}
+
+// FindChildren returns the direct children of a node, or the root nodes when parentID is nil.
+func (r *HierarchyRepository) FindChildren(parentID *uint) ([]*model.Hierarchy, error) {
+	var nodes []*model.Hierarchy
+	query := r.db.Order("position ASC").Order("name ASC")
+
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+
+	err := query.Find(&nodes).Error
+
+	return nodes, err
+}
+
+// NextPosition returns the position that places a new node after all of its future siblings.
+func (r *HierarchyRepository) NextPosition(parentID *uint) (int, error) {
+	var next int
+	query := r.db.Model(&model.Hierarchy{}).Select("COALESCE(MAX(position), -1) + 1")
+
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+
+	err := query.Scan(&next).Error
+
+	return next, err
+}
+
+// UpdatePositions stores the order of siblings, giving each id its index in the slice as position.
+func (r *HierarchyRepository) UpdatePositions(ids []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for i, id := range ids {
+			if err := tx.Model(&model.Hierarchy{}).Where("id = ?", id).Update("position", i).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FirstPictureTimes returns the earliest capture time of every album that has dated pictures.
+func (r *HierarchyRepository) FirstPictureTimes() (map[uint]time.Time, error) {
+	var rows []struct {
+		HierarchyID uint
+		First       sqlTime
+	}
+
+	err := r.db.Model(&model.Picture{}).
+		Select("sub_folders.hierarchy_id AS hierarchy_id, MIN(pictures.captured_at) AS first").
+		Joins("JOIN sub_folders ON sub_folders.id = pictures.sub_folder_id").
+		Where("pictures.captured_at IS NOT NULL").
+		Group("sub_folders.hierarchy_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	times := make(map[uint]time.Time, len(rows))
+	for _, row := range rows {
+		if row.First.Valid {
+			times[row.HierarchyID] = row.First.Time
+		}
+	}
+
+	return times, nil
+}
+
+// FindAllNodes loads every node without its subfolders or pictures.
+func (r *HierarchyRepository) FindAllNodes() ([]*model.Hierarchy, error) {
+	var nodes []*model.Hierarchy
+	err := r.db.Order("name ASC").Find(&nodes).Error
+
+	return nodes, err
+}
+
+// ResolveCovers returns the cover picture of every album holding pictures. The chosen cover wins
+// while it is still in the album, otherwise the highest-rated picture is used, preferring JPGs
+// and then the lowest index. Passing album ids limits the lookup to those albums.
+func (r *HierarchyRepository) ResolveCovers(albumIDs ...uint) (map[uint]uint, error) {
+	var rows []struct {
+		HierarchyID uint
+		PictureID   uint
+	}
+
+	filter, args := "", []any{"jpg", model.TypeAlbum}
+	if len(albumIDs) > 0 {
+		filter = "AND hierarchies.id IN ?"
+		args = append(args, albumIDs)
+	}
+
+	err := r.db.Raw(`
+		SELECT hierarchy_id, picture_id FROM (
+			SELECT sub_folders.hierarchy_id AS hierarchy_id, pictures.id AS picture_id,
+				ROW_NUMBER() OVER (
+					PARTITION BY sub_folders.hierarchy_id
+					ORDER BY pictures.id = COALESCE(hierarchies.cover_picture_id, 0) DESC,
+						pictures.rating DESC,
+						pictures.type = ? DESC,
+						pictures."index" ASC,
+						pictures.id ASC
+				) AS rank
+			FROM pictures
+			JOIN sub_folders ON sub_folders.id = pictures.sub_folder_id
+			JOIN hierarchies ON hierarchies.id = sub_folders.hierarchy_id
+			WHERE hierarchies.type = ? `+filter+`
+		) WHERE rank = 1`, args...).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	covers := make(map[uint]uint, len(rows))
+	for _, row := range rows {
+		covers[row.HierarchyID] = row.PictureID
+	}
+
+	return covers, nil
+}
+
+// FindAncestors returns the chain of nodes from the root down to and including the given node.
+func (r *HierarchyRepository) FindAncestors(id uint) ([]*model.Hierarchy, error) {
+	var nodes []*model.Hierarchy
+	err := r.db.Raw(`
+		WITH RECURSIVE ancestors(id, parent_id, depth) AS (
+			SELECT id, parent_id, 0 FROM hierarchies WHERE id = ?
+			UNION ALL
+			SELECT h.id, h.parent_id, a.depth + 1 FROM hierarchies h JOIN ancestors a ON h.id = a.parent_id
+		)
+		SELECT hierarchies.* FROM hierarchies
+		JOIN ancestors ON ancestors.id = hierarchies.id
+		ORDER BY ancestors.depth DESC`, id).
+		Scan(&nodes).Error
+
+	return nodes, err
+}
+
+// CountPicturesByNode returns the number of pictures stored in each album.
+func (r *HierarchyRepository) CountPicturesByNode() (map[uint]int64, error) {
+	var rows []struct {
+		HierarchyID uint
+		Count       int64
+	}
+
+	err := r.db.Model(&model.Picture{}).
+		Select("sub_folders.hierarchy_id AS hierarchy_id, COUNT(*) AS count").
+		Joins("JOIN sub_folders ON sub_folders.id = pictures.sub_folder_id").
+		Group("sub_folders.hierarchy_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.HierarchyID] = row.Count
+	}
+
+	return counts, nil
+}
+
+// BranchTotals holds the pictures stored in a node and every album below it.
+type BranchTotals struct {
+	Children     int
+	Pictures     int64
+	FirstCapture *time.Time
+}
+
+// FindBranchTotals returns the totals of every direct child of a node, or of the root nodes when
+// parentID is nil. Only the branches below those children are read.
+func (r *HierarchyRepository) FindBranchTotals(parentID *uint) (map[uint]BranchTotals, error) {
+	level, args := "parent_id IS NULL", []any{}
+	if parentID != nil {
+		level, args = "parent_id = ?", append(args, *parentID)
+	}
+
+	var pictureRows []struct {
+		RootID   uint
+		Pictures int64
+		First    sqlTime
+	}
+
+	err := r.db.Raw(`
+		WITH RECURSIVE branch(root_id, id) AS (
+			SELECT id, id FROM hierarchies WHERE `+level+`
+			UNION ALL
+			SELECT b.root_id, h.id FROM hierarchies h JOIN branch b ON h.parent_id = b.id
+		)
+		SELECT branch.root_id AS root_id, COUNT(pictures.id) AS pictures, MIN(pictures.captured_at) AS first
+		FROM branch
+		JOIN sub_folders ON sub_folders.hierarchy_id = branch.id
+		JOIN pictures ON pictures.sub_folder_id = sub_folders.id
+		GROUP BY branch.root_id`, args...).
+		Scan(&pictureRows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var childRows []struct {
+		ParentID uint
+		Children int
+	}
+
+	err = r.db.Raw(`
+		SELECT parent_id, COUNT(*) AS children FROM hierarchies
+		WHERE parent_id IN (SELECT id FROM hierarchies WHERE `+level+`)
+		GROUP BY parent_id`, args...).
+		Scan(&childRows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[uint]BranchTotals, len(pictureRows))
+	for _, row := range pictureRows {
+		t := BranchTotals{Pictures: row.Pictures}
+		if row.First.Valid {
+			t.FirstCapture = &row.First.Time
+		}
+		totals[row.RootID] = t
+	}
+	for _, row := range childRows {
+		t := totals[row.ParentID]
+		t.Children = row.Children
+		totals[row.ParentID] = t
+	}
+
+	return totals, nil
+}
+
+// FindDuplicate reports whether a sibling with the same name and type exists under parentID.
+// The node with excludeID is ignored so a node never collides with itself; pass 0 to check all siblings.
+func (r *HierarchyRepository) FindDuplicate(parentID *uint, name string, nodeType model.HierarchyType, excludeID uint) (bool, error) {
 	var count int64
 	query := r.db.Model(&model.Hierarchy{}).Where("name = ? AND type = ?", name, nodeType)
 
+	if excludeID != 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+
 	if parentID == nil {
 		query = query.Where("parent_id IS NULL")
 	} else {
@@ -45,3 +376,86 @@ func (r *HierarchyRepository) FindDuplicate(parentID *uint, name string, nodeTyp
 
 	return count > 0, nil
 }
+
+// SubtreeCounts summarises the rows below and including a node.
+type SubtreeCounts struct {
+	Folders    int64 `json:"folders"`
+	Albums     int64 `json:"albums"`
+	Smart      int64 `json:"smart"`
+	SubFolders int64 `json:"sub_folders"`
+	Pictures   int64 `json:"pictures"`
+}
+
+// FindSubtree returns the node with the given id and all of its descendants.
+func (r *HierarchyRepository) FindSubtree(id uint) ([]model.Hierarchy, error) {
+	var nodes []model.Hierarchy
+	err := r.db.Raw(`
+		WITH RECURSIVE subtree(id) AS (
+			SELECT id FROM hierarchies WHERE id = ?
+			UNION ALL
+			SELECT h.id FROM hierarchies h JOIN subtree s ON h.parent_id = s.id
+		)
+		SELECT * FROM hierarchies WHERE id IN (SELECT id FROM subtree)`, id).
+		Scan(&nodes).Error
+
+	return nodes, err
+}
+
+// CountSubtree counts the nodes, subfolders and pictures owned by the given node ids.
+func (r *HierarchyRepository) CountSubtree(nodes []model.Hierarchy) (SubtreeCounts, error) {
+	var counts SubtreeCounts
+	ids := make([]uint, 0, len(nodes))
+
+	for _, n := range nodes {
+		ids = append(ids, n.ID)
+		switch n.Type {
+		case model.TypeFolder:
+			counts.Folders++
+		case model.TypeAlbum:
+			counts.Albums++
+		case model.TypeSmart:
+			counts.Smart++
+		}
+	}
+
+	if err := r.db.Model(&model.SubFolder{}).Where("hierarchy_id IN ?", ids).Count(&counts.SubFolders).Error; err != nil {
+		return counts, err
+	}
+
+	err := r.db.Model(&model.Picture{}).
+		Joins("JOIN sub_folders ON sub_folders.id = pictures.sub_folder_id").
+		Where("sub_folders.hierarchy_id IN ?", ids).
+		Count(&counts.Pictures).Error
+
+	return counts, err
+}
+
+// DeleteSubtree removes the given nodes together with their subfolders, pictures and metadata in one transaction.
+func (r *HierarchyRepository) DeleteSubtree(ids []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		subFolderIDs := tx.Model(&model.SubFolder{}).Select("id").Where("hierarchy_id IN ?", ids)
+		pictureIDs := tx.Model(&model.Picture{}).Select("id").Where("sub_folder_id IN (?)", subFolderIDs)
+
+		if err := tx.Where("picture_id IN (?)", pictureIDs).Delete(&model.PictureMetadata{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec("DELETE FROM picture_tags WHERE picture_id IN (?)", pictureIDs).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("sub_folder_id IN (?)", subFolderIDs).Delete(&model.Picture{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("hierarchy_id IN ?", ids).Delete(&model.SubFolder{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("hierarchy_id IN ?", ids).Delete(&model.AlbumAttribute{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id IN ?", ids).Delete(&model.Hierarchy{}).Error
+	})
+}
@@ -2,10 +2,46 @@ package repository
 
 import (
 	"picturebot-backend/internal/model"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// PictureSortColumns maps the public sort keys to their picture columns.
+var PictureSortColumns = map[string]string{
+	"index":       "index",
+	"captured_at": "captured_at",
+	"rating":      "rating",
+	"file_name":   "file_name",
+	"size":        "size",
+}
+
+// PictureFieldColumns lists the picture columns that may be selected with a field projection.
+var PictureFieldColumns = map[string]bool{
+	"id":            true,
+	"file_name":     true,
+	"index":         true,
+	"extension":     true,
+	"type":          true,
+	"location":      true,
+	"rating":        true,
+	"captured_at":   true,
+	"size":          true,
+	"flag":          true,
+	"sub_folder_id": true,
+}
+
+// PictureQuery holds paging, ordering and projection options for picture listings.
+// A zero Limit returns every matching row from Offset on.
+type PictureQuery struct {
+	Limit  int
+	Offset int
+	Sort   string
+	Desc   bool
+	Fields []string
+}
+
 type PictureRepository struct {
 	db *gorm.DB
 }
@@ -20,25 +56,181 @@ func (r *PictureRepository) Create(picture *model.Picture) error {
 	return err
 }
 
-func (r *PictureRepository) FindAll() ([]model.Picture, error) {
-	var pictures []model.Picture
-	err := r.db.Find(&pictures).Error
+// UpdateFiles stores the new index, file name, extension, location and subfolder of each picture in one
+// transaction. MissingAt is stored along, so a picture found again under a new name is no longer missing.
+func (r *PictureRepository) UpdateFiles(pictures []*model.Picture) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, p := range pictures {
+			err := tx.Model(p).Select("index", "file_name", "extension", "location", "sub_folder_id", "missing_at").Updates(p).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-	return pictures, err
+func (r *PictureRepository) FindAll(q PictureQuery) ([]model.Picture, int64, error) {
+	return r.list(r.db.Model(&model.Picture{}), q)
 }
 
 func (r *PictureRepository) FindByID(id uint) (*model.Picture, error) {
 	var picture model.Picture
-	err := r.db.Preload("SubFolder").First(&picture, id).Error
+	err := r.db.Preload("SubFolder").Preload("Metadata").Preload("Tags").First(&picture, id).Error
 
 	return &picture, err
 }
 
-func (r *PictureRepository) FindByHierarchyID(hierarchyID uint) ([]model.Picture, error) {
+func (r *PictureRepository) FindByIDs(ids []uint) ([]model.Picture, error) {
+	var pictures []model.Picture
+	err := r.db.Preload("SubFolder").Where("id IN ?", ids).Find(&pictures).Error
+
+	return pictures, err
+}
+
+// FindAlbumIDs returns the albums holding the given pictures.
+func (r *PictureRepository) FindAlbumIDs(ids []uint) ([]uint, error) {
+	var albumIDs []uint
+	err := r.db.Model(&model.Picture{}).
+		Distinct("sub_folders.hierarchy_id").
+		Joins("JOIN sub_folders ON sub_folders.id = pictures.sub_folder_id").
+		Where("pictures.id IN ?", ids).
+		Pluck("sub_folders.hierarchy_id", &albumIDs).Error
+
+	return albumIDs, err
+}
+
+// FindAllFiles returns every picture with only the columns needed to compare the catalog with the disk.
+func (r *PictureRepository) FindAllFiles() ([]model.Picture, error) {
+	var pictures []model.Picture
+	err := r.db.Select("id", "file_name", "index", "location", "size", "hash", "sub_folder_id").
+		Order("id ASC").
+		Find(&pictures).Error
+
+	return pictures, err
+}
+
+// UpdateChecksum stores the size and hash measured on disk for a picture. The file is accepted
+// as it is, so a corruption recorded by the scrubber is cleared as well.
+func (r *PictureRepository) UpdateChecksum(id uint, size int64, hash string) error {
+	return r.db.Model(&model.Picture{}).Where("id = ?", id).
+		Updates(map[string]any{"size": size, "hash": hash, "verified_at": time.Now(), "corrupted_at": nil, "corruption": "", "missing_at": nil}).Error
+}
+
+// SetReview stores the rating and pick flag of a picture.
+func (r *PictureRepository) SetReview(id uint, rating int, flag string) error {
+	return r.db.Model(&model.Picture{}).Where("id = ?", id).
+		Updates(map[string]any{"rating": rating, "flag": flag}).Error
+}
+
+// FindByLocation returns the picture stored at the given path.
+func (r *PictureRepository) FindByLocation(path string) (*model.Picture, error) {
 	var pictures []model.Picture
-	err := r.db.Joins("JOIN sub_folders ON sub_folders.id = pictures.sub_folder_id").
-		Where("sub_folders.hierarchy_id = ?", hierarchyID).
+	if err := r.db.Where("location = ?", path).Limit(1).Find(&pictures).Error; err != nil {
+		return nil, err
+	}
+	if len(pictures) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return &pictures[0], nil
+}
+
+// FindMissingByHash returns the missing pictures of an album whose content had the given hash.
+func (r *PictureRepository) FindMissingByHash(hierarchyID uint, hash string) ([]model.Picture, error) {
+	var pictures []model.Picture
+	err := r.db.
+		Joins("JOIN sub_folders ON sub_folders.id = pictures.sub_folder_id").
+		Where("sub_folders.hierarchy_id = ? AND pictures.hash = ? AND pictures.missing_at IS NOT NULL", hierarchyID, hash).
+		Order("pictures.missing_at DESC").
 		Find(&pictures).Error
 
 	return pictures, err
 }
+
+// MarkMissing records that a picture's file was deleted.
+func (r *PictureRepository) MarkMissing(id uint, at time.Time) error {
+	return r.db.Model(&model.Picture{}).Where("id = ?", id).Update("missing_at", at).Error
+}
+
+// Delete removes pictures together with their metadata and tag assignments.
+func (r *PictureRepository) Delete(ids []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("picture_id IN ?", ids).Delete(&model.PictureMetadata{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec("DELETE FROM picture_tags WHERE picture_id IN ?", ids).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id IN ?", ids).Delete(&model.Picture{}).Error
+	})
+}
+
+// ExpandShots adds the ids of every file sharing a shot with one of the given pictures,
+// that is every picture with the same index in the same album.
+func (r *PictureRepository) ExpandShots(ids []uint) ([]uint, error) {
+	var expanded []uint
+	err := r.db.Raw(`
+		SELECT DISTINCT p.id FROM pictures p
+		JOIN sub_folders sf ON sf.id = p.sub_folder_id
+		JOIN (
+			SELECT pictures."index" AS idx, sub_folders.hierarchy_id AS hierarchy_id FROM pictures
+			JOIN sub_folders ON sub_folders.id = pictures.sub_folder_id
+			WHERE pictures.id IN ?
+		) shots ON shots.idx = p."index" AND shots.hierarchy_id = sf.hierarchy_id
+		ORDER BY p.id`, ids).
+		Scan(&expanded).Error
+
+	return expanded, err
+}
+
+func (r *PictureRepository) FindByHierarchyID(hierarchyID uint, q PictureQuery) ([]model.Picture, int64, error) {
+	query := r.db.Model(&model.Picture{}).
+		Joins("JOIN sub_folders ON sub_folders.id = pictures.sub_folder_id").
+		Where("sub_folders.hierarchy_id = ?", hierarchyID)
+
+	return r.list(query, q)
+}
+
+// list counts the rows matched by query and then fetches the requested page.
+func (r *PictureRepository) list(query *gorm.DB, q PictureQuery) ([]model.Picture, int64, error) {
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if len(q.Fields) > 0 {
+		columns := make([]clause.Column, 0, len(q.Fields))
+		for _, f := range q.Fields {
+			columns = append(columns, clause.Column{Table: "pictures", Name: f})
+		}
+		query = query.Clauses(clause.Select{Columns: columns})
+	} else {
+		query = query.Preload("Metadata")
+	}
+
+	sortColumn := "id"
+	if col, ok := PictureSortColumns[q.Sort]; ok {
+		sortColumn = col
+	}
+	query = query.Order(clause.OrderByColumn{Column: clause.Column{Table: "pictures", Name: sortColumn}, Desc: q.Desc})
+
+	// Keep the order stable when several rows share the same sort value
+	if sortColumn != "id" {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Table: "pictures", Name: "id"}})
+	}
+
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+	if q.Offset > 0 {
+		query = query.Offset(q.Offset)
+	}
+
+	var pictures []model.Picture
+	err := query.Find(&pictures).Error
+
+	return pictures, total, err
+}
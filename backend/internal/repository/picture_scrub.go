@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"picturebot-backend/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ScrubCounts summarises the verification state of the library.
+type ScrubCounts struct {
+	Pictures   int64 `json:"pictures"`
+	Unverified int64 `json:"unverified"` // Never re-read since import
+	Due        int64 `json:"due"`        // Not verified within the scrub interval, including unverified ones
+	Corrupted  int64 `json:"corrupted"`
+}
+
+// FindDueForScrub returns up to limit pictures not verified since before, never verified ones first.
+func (r *PictureRepository) FindDueForScrub(before time.Time, limit int) ([]model.Picture, error) {
+	var pictures []model.Picture
+	err := r.db.Select("id", "file_name", "location", "size", "hash", "verified_at", "corrupted_at", "sub_folder_id").
+		Where("verified_at IS NULL OR verified_at < ?", before).
+		Order("verified_at IS NOT NULL, verified_at ASC, id ASC").
+		Limit(limit).
+		Find(&pictures).Error
+
+	return pictures, err
+}
+
+// MarkVerified records that a picture's file matched its hash. A non-empty hash is stored as the
+// reference for pictures imported before hashes were recorded.
+func (r *PictureRepository) MarkVerified(id uint, hash string, at time.Time) error {
+	updates := map[string]any{"verified_at": at, "corrupted_at": nil, "corruption": ""}
+	if hash != "" {
+		updates["hash"] = hash
+	}
+
+	return r.db.Model(&model.Picture{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// MarkCorrupted records a failed verification. CorruptedAt keeps the time the problem was first seen.
+func (r *PictureRepository) MarkCorrupted(id uint, detail string, at time.Time) error {
+	return r.db.Model(&model.Picture{}).Where("id = ?", id).Updates(map[string]any{
+		"verified_at":  at,
+		"corrupted_at": gorm.Expr("COALESCE(corrupted_at, ?)", at),
+		"corruption":   detail,
+	}).Error
+}
+
+// FindCorrupted returns every picture that failed its last verification, oldest problem first.
+func (r *PictureRepository) FindCorrupted() ([]model.Picture, error) {
+	var pictures []model.Picture
+	err := r.db.Where("corrupted_at IS NOT NULL").
+		Order("corrupted_at ASC, id ASC").
+		Find(&pictures).Error
+
+	return pictures, err
+}
+
+// CountScrub counts the pictures per verification state. Pictures last verified before the given
+// time are due; a nil time means scheduled scrubbing is off and only unverified pictures are due.
+func (r *PictureRepository) CountScrub(before *time.Time) (ScrubCounts, error) {
+	var counts ScrubCounts
+
+	due := "verified_at IS NULL"
+	var args []any
+	if before != nil {
+		due += " OR verified_at < ?"
+		args = append(args, *before)
+	}
+
+	err := r.db.Model(&model.Picture{}).
+		Select(`COUNT(*) AS pictures,
+			COALESCE(SUM(CASE WHEN verified_at IS NULL THEN 1 ELSE 0 END), 0) AS unverified,
+			COALESCE(SUM(CASE WHEN `+due+` THEN 1 ELSE 0 END), 0) AS due,
+			COALESCE(SUM(CASE WHEN corrupted_at IS NOT NULL THEN 1 ELSE 0 END), 0) AS corrupted`, args...).
+		Scan(&counts).Error
+
+	return counts, err
+}
@@ -0,0 +1,258 @@
+package repository
+
+import (
+	"fmt"
+	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/search"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// searchColumns maps numeric and text search fields to the SQL expression they compare against.
+// album, folder and taken need more than a single column and are handled in buildTerm.
+var searchColumns = map[string]string{
+	"rating":   "pictures.rating",
+	"iso":      "COALESCE(picture_metadata.iso, 0)",
+	"aperture": "COALESCE(picture_metadata.aperture, 0)",
+	"focal":    "COALESCE(picture_metadata.focal_length, 0)",
+	"camera":   "COALESCE(picture_metadata.camera, '')",
+	"lens":     "COALESCE(picture_metadata.lens, '')",
+	"file":     "pictures.file_name",
+	"type":     "pictures.type",
+	"ext":      "pictures.extension",
+
+	"location": "hierarchies.location",
+	"client":   "hierarchies.client",
+	"contact":  "hierarchies.contact",
+}
+
+// Search returns the pictures matching a parsed search query, joined with their album and metadata.
+// A nil node matches every picture.
+func (r *PictureRepository) Search(node search.Node, q PictureQuery) ([]model.Picture, int64, error) {
+	query, err := r.searchQuery(node)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return r.list(query, q)
+}
+
+// SearchAlbums returns the albums whose details or pictures match a parsed search query.
+// Albums without pictures can still match on album fields such as client or event.
+func (r *HierarchyRepository) SearchAlbums(node search.Node) ([]*model.Hierarchy, error) {
+	query := r.db.Model(&model.Hierarchy{}).
+		Joins("LEFT JOIN sub_folders ON sub_folders.hierarchy_id = hierarchies.id").
+		Joins("LEFT JOIN pictures ON pictures.sub_folder_id = sub_folders.id").
+		Joins("LEFT JOIN picture_metadata ON picture_metadata.picture_id = pictures.id").
+		Where("hierarchies.type = ?", model.TypeAlbum)
+
+	if node != nil {
+		where, args, err := buildSearchClause(node)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(where, args...)
+	}
+
+	var albums []*model.Hierarchy
+	err := query.
+		Select("hierarchies.*").
+		Group("hierarchies.id").
+		Preload("Attributes", func(db *gorm.DB) *gorm.DB { return db.Order("key ASC") }).
+		Order("hierarchies.name ASC").
+		Find(&albums).Error
+
+	return albums, err
+}
+
+// searchQuery builds the filtered picture query shared by Search and SearchStats.
+func (r *PictureRepository) searchQuery(node search.Node) (*gorm.DB, error) {
+	query := r.db.Model(&model.Picture{}).
+		Joins("JOIN sub_folders ON sub_folders.id = pictures.sub_folder_id").
+		Joins("JOIN hierarchies ON hierarchies.id = sub_folders.hierarchy_id").
+		Joins("LEFT JOIN picture_metadata ON picture_metadata.picture_id = pictures.id")
+
+	if node != nil {
+		where, args, err := buildSearchClause(node)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(where, args...)
+	}
+
+	return query, nil
+}
+
+// buildSearchClause translates a query tree into a SQL condition with positional arguments.
+func buildSearchClause(node search.Node) (string, []any, error) {
+	switch n := node.(type) {
+	case search.And:
+		return joinClauses(" AND ", n.Nodes)
+	case search.Or:
+		return joinClauses(" OR ", n.Nodes)
+	case search.Not:
+		where, args, err := buildSearchClause(n.Node)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + where + ")", args, nil
+	case search.Term:
+		return buildTerm(n)
+	default:
+		return "", nil, fmt.Errorf("unsupported search node %T", node)
+	}
+}
+
+func joinClauses(sep string, nodes []search.Node) (string, []any, error) {
+	parts := make([]string, 0, len(nodes))
+	var args []any
+
+	for _, child := range nodes {
+		where, childArgs, err := buildSearchClause(child)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, "("+where+")")
+		args = append(args, childArgs...)
+	}
+
+	return strings.Join(parts, sep), args, nil
+}
+
+func buildTerm(t search.Term) (string, []any, error) {
+	switch t.Field {
+	case "":
+		return `pictures.file_name LIKE ? ESCAPE '\'`, []any{"%" + likePattern(t.Value) + "%"}, nil
+	case "album":
+		return `hierarchies.name LIKE ? ESCAPE '\'`, []any{likePattern(t.Value)}, nil
+	case "folder":
+		// Match albums that sit anywhere below a folder with a matching name
+		return `hierarchies.id IN (
+			WITH RECURSIVE descendants(id) AS (
+				SELECT id FROM hierarchies WHERE type = ? AND name LIKE ? ESCAPE '\'
+				UNION ALL
+				SELECT h.id FROM hierarchies h JOIN descendants d ON h.parent_id = d.id
+			)
+			SELECT id FROM descendants)`, []any{model.TypeFolder, likePattern(t.Value)}, nil
+	case "taken":
+		return buildDateTerm("pictures.captured_at", t)
+	case "event":
+		return buildEventTerm(t)
+	case "tag":
+		pattern := likePattern(t.Value)
+		return `EXISTS (SELECT 1 FROM picture_tags pt JOIN tags t ON t.id = pt.tag_id
+			WHERE pt.picture_id = pictures.id AND (t.path LIKE ? ESCAPE '\' OR t.path LIKE ? ESCAPE '\'))`,
+			[]any{pattern, pattern + model.TagSeparator + "%"}, nil
+	case "description":
+		return `hierarchies.description LIKE ? ESCAPE '\'`, []any{"%" + likePattern(t.Value) + "%"}, nil
+	case "attr":
+		key, value, hasValue := strings.Cut(t.Value, "=")
+		where := `EXISTS (SELECT 1 FROM album_attributes a WHERE a.hierarchy_id = hierarchies.id AND a.key LIKE ? ESCAPE '\'`
+		args := []any{likePattern(key)}
+		if hasValue {
+			where += ` AND a.value LIKE ? ESCAPE '\'`
+			args = append(args, likePattern(value))
+		}
+		return where + ")", args, nil
+	}
+
+	column, ok := searchColumns[t.Field]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown search field %q", t.Field)
+	}
+
+	switch search.Fields[t.Field] {
+	case search.KindInt:
+		v, err := strconv.Atoi(t.Value)
+		if err != nil {
+			return "", nil, err
+		}
+		return column + " " + sqlOp(t.Op) + " ?", []any{v}, nil
+	case search.KindFloat:
+		v, err := strconv.ParseFloat(t.Value, 64)
+		if err != nil {
+			return "", nil, err
+		}
+		return column + " " + sqlOp(t.Op) + " ?", []any{v}, nil
+	default:
+		return column + ` LIKE ? ESCAPE '\'`, []any{likePattern(t.Value)}, nil
+	}
+}
+
+// buildDateTerm compares a time column against the year, month or day named by the value.
+func buildDateTerm(column string, t search.Term) (string, []any, error) {
+	start, end, err := search.DateRange(t.Value)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch t.Op {
+	case search.OpGt:
+		return column + " >= ?", []any{end}, nil
+	case search.OpGte:
+		return column + " >= ?", []any{start}, nil
+	case search.OpLt:
+		return column + " < ?", []any{start}, nil
+	case search.OpLte:
+		return column + " < ?", []any{end}, nil
+	default:
+		return column + " >= ? AND " + column + " < ?", []any{start, end}, nil
+	}
+}
+
+// buildEventTerm matches albums by their event dates. With ":" any overlap between the event
+// and the named period matches; the other operators compare the event start.
+func buildEventTerm(t search.Term) (string, []any, error) {
+	if t.Op != search.OpEq {
+		return buildDateTerm("hierarchies.event_start", t)
+	}
+
+	start, end, err := search.DateRange(t.Value)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "hierarchies.event_start < ? AND COALESCE(hierarchies.event_end, hierarchies.event_start) >= ?", []any{end, start}, nil
+}
+
+func sqlOp(op search.Op) string {
+	if op == search.OpEq {
+		return "="
+	}
+	return string(op)
+}
+
+// likePattern escapes LIKE metacharacters and turns the "*" and "?" wildcards into "%" and "_".
+func likePattern(value string) string {
+	var sb strings.Builder
+	for _, r := range value {
+		switch r {
+		case '*':
+			sb.WriteRune('%')
+		case '?':
+			sb.WriteRune('_')
+		default:
+			writeLikeRune(&sb, r)
+		}
+	}
+	return sb.String()
+}
+
+// likeLiteral escapes LIKE metacharacters so value only matches itself, e.g. a stored tag path.
+func likeLiteral(value string) string {
+	var sb strings.Builder
+	for _, r := range value {
+		writeLikeRune(&sb, r)
+	}
+	return sb.String()
+}
+
+// writeLikeRune writes r, escaped when LIKE would treat it as a wildcard or the escape character.
+func writeLikeRune(sb *strings.Builder, r rune) {
+	if r == '\\' || r == '%' || r == '_' {
+		sb.WriteRune('\\')
+	}
+	sb.WriteRune(r)
+}
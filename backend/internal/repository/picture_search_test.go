@@ -0,0 +1,39 @@
+package repository
+
+import "testing"
+
+func TestLikePattern(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"Wedding", "Wedding"},
+		{"Wed*", "Wed%"},
+		{"IMG_00?", `IMG\_00_`},
+		{"100%", `100\%`},
+		{`a\b*`, `a\\b%`},
+	}
+
+	for _, tt := range tests {
+		if got := likePattern(tt.value); got != tt.want {
+			t.Errorf("likePattern(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLikeLiteral(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"Places/Belgium", "Places/Belgium"},
+		{"Places/*", "Places/*"},
+		{"a?b", "a?b"},
+		{"50%_off", `50\%\_off`},
+		{`a\b`, `a\\b`},
+	}
+
+	for _, tt := range tests {
+		if got := likeLiteral(tt.value); got != tt.want {
+			t.Errorf("likeLiteral(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/search"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// NodeStats aggregates the pictures of an album, or of every album below a folder.
+type NodeStats struct {
+	Shots        int64         `json:"shots"`
+	Pictures     int64         `json:"pictures"`
+	RawFiles     int64         `json:"raw_files"`
+	JpgFiles     int64         `json:"jpg_files"`
+	TotalBytes   int64         `json:"total_bytes"`
+	FirstCapture *time.Time    `json:"first_capture"`
+	LastCapture  *time.Time    `json:"last_capture"`
+	Ratings      map[int]int64 `json:"ratings"` // Number of pictures per star rating
+	Picks        int64         `json:"picks"`
+	Rejects      int64         `json:"rejects"`
+}
+
+// NewNodeStats returns empty stats ready to be added to.
+func NewNodeStats() *NodeStats {
+	return &NodeStats{Ratings: map[int]int64{}}
+}
+
+// Add folds other into s, widening the capture range as needed.
+func (s *NodeStats) Add(other *NodeStats) {
+	s.Shots += other.Shots
+	s.Pictures += other.Pictures
+	s.RawFiles += other.RawFiles
+	s.JpgFiles += other.JpgFiles
+	s.TotalBytes += other.TotalBytes
+	s.Picks += other.Picks
+	s.Rejects += other.Rejects
+
+	if other.FirstCapture != nil && (s.FirstCapture == nil || other.FirstCapture.Before(*s.FirstCapture)) {
+		s.FirstCapture = other.FirstCapture
+	}
+	if other.LastCapture != nil && (s.LastCapture == nil || other.LastCapture.After(*s.LastCapture)) {
+		s.LastCapture = other.LastCapture
+	}
+
+	for rating, count := range other.Ratings {
+		s.Ratings[rating] += count
+	}
+}
+
+// StatsByAlbum returns the stats of every album that holds at least one picture, keyed by hierarchy id.
+func (r *PictureRepository) StatsByAlbum() (map[uint]*NodeStats, error) {
+	return collectStats(func() *gorm.DB {
+		return r.db.Model(&model.Picture{}).
+			Joins("JOIN sub_folders ON sub_folders.id = pictures.sub_folder_id")
+	})
+}
+
+// SubtreeStats returns the combined stats of the albums at or below a node.
+func (r *PictureRepository) SubtreeStats(id uint) (*NodeStats, error) {
+	byAlbum, err := collectStats(func() *gorm.DB {
+		return r.db.Model(&model.Picture{}).
+			Joins("JOIN sub_folders ON sub_folders.id = pictures.sub_folder_id").
+			Where(`sub_folders.hierarchy_id IN (
+				WITH RECURSIVE subtree(id) AS (
+					SELECT id FROM hierarchies WHERE id = ?
+					UNION ALL
+					SELECT h.id FROM hierarchies h JOIN subtree s ON h.parent_id = s.id
+				)
+				SELECT id FROM subtree)`, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	total := NewNodeStats()
+	for _, stats := range byAlbum {
+		total.Add(stats)
+	}
+
+	return total, nil
+}
+
+// SearchStats returns the combined stats of the pictures matching a parsed search query.
+func (r *PictureRepository) SearchStats(node search.Node) (*NodeStats, error) {
+	// Validate the query once so the builder below cannot fail
+	if _, err := r.searchQuery(node); err != nil {
+		return nil, err
+	}
+
+	byAlbum, err := collectStats(func() *gorm.DB {
+		query, _ := r.searchQuery(node)
+		return query
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	total := NewNodeStats()
+	for _, stats := range byAlbum {
+		total.Add(stats)
+	}
+
+	return total, nil
+}
+
+// collectStats aggregates the pictures selected by base per album. base must join sub_folders
+// and is called once per query because gorm statements cannot be reused.
+func collectStats(base func() *gorm.DB) (map[uint]*NodeStats, error) {
+	var rows []struct {
+		HierarchyID  uint
+		Shots        int64
+		Pictures     int64
+		RawFiles     int64
+		JpgFiles     int64
+		TotalBytes   int64
+		Picks        int64
+		Rejects      int64
+		FirstCapture sqlTime
+		LastCapture  sqlTime
+	}
+
+	// A shot is every file sharing an index within one album
+	err := base().
+		Select(`sub_folders.hierarchy_id AS hierarchy_id,
+			COUNT(DISTINCT pictures."index") AS shots,
+			COUNT(*) AS pictures,
+			COALESCE(SUM(pictures.type = 'raw'), 0) AS raw_files,
+			COALESCE(SUM(pictures.type = 'jpg'), 0) AS jpg_files,
+			COALESCE(SUM(pictures.size), 0) AS total_bytes,
+			COALESCE(SUM(pictures.flag = ?), 0) AS picks,
+			COALESCE(SUM(pictures.flag = ?), 0) AS rejects,
+			MIN(pictures.captured_at) AS first_capture,
+			MAX(pictures.captured_at) AS last_capture`, model.FlagPick, model.FlagReject).
+		Group("sub_folders.hierarchy_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[uint]*NodeStats, len(rows))
+	for _, row := range rows {
+		s := NewNodeStats()
+		s.Shots = row.Shots
+		s.Pictures = row.Pictures
+		s.RawFiles = row.RawFiles
+		s.JpgFiles = row.JpgFiles
+		s.TotalBytes = row.TotalBytes
+		s.Picks = row.Picks
+		s.Rejects = row.Rejects
+		if row.FirstCapture.Valid {
+			s.FirstCapture = &row.FirstCapture.Time
+		}
+		if row.LastCapture.Valid {
+			s.LastCapture = &row.LastCapture.Time
+		}
+		stats[row.HierarchyID] = s
+	}
+
+	var ratings []struct {
+		HierarchyID uint
+		Rating      int
+		Count       int64
+	}
+
+	err = base().
+		Select("sub_folders.hierarchy_id AS hierarchy_id, pictures.rating AS rating, COUNT(*) AS count").
+		Group("sub_folders.hierarchy_id, pictures.rating").
+		Scan(&ratings).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range ratings {
+		if s, ok := stats[row.HierarchyID]; ok {
+			s.Ratings[row.Rating] = row.Count
+		}
+	}
+
+	return stats, nil
+}
@@ -25,3 +25,11 @@ func (r *SettingsRepository) UpdateSettings(settings *model.Settings) error {
 	settings.ID = 1
 	return r.db.Save(settings).Error
 }
+
+// SetRootSortMode changes only the root ordering, leaving concurrent changes to other settings intact.
+func (r *SettingsRepository) SetRootSortMode(mode model.SortMode) error {
+	if _, err := r.GetSettings(); err != nil {
+		return err
+	}
+	return r.db.Model(&model.Settings{ID: 1}).Update("root_sort_mode", mode).Error
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// sqlTimeLayouts are the formats the SQLite driver writes timestamps in.
+var sqlTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+}
+
+// sqlTime scans timestamps produced by aggregates such as MIN and MAX.
+// SQLite returns those as plain text because the column type is lost.
+type sqlTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (t *sqlTime) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		t.Time, t.Valid = time.Time{}, false
+		return nil
+	case time.Time:
+		t.Time, t.Valid = v, true
+		return nil
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a timestamp", value)
+	}
+}
+
+// Value lets GORM treat sqlTime as a plain column when it builds its schema.
+func (t sqlTime) Value() (driver.Value, error) {
+	if !t.Valid {
+		return nil, nil
+	}
+	return t.Time, nil
+}
+
+func (t *sqlTime) parse(s string) error {
+	for _, layout := range sqlTimeLayouts {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			t.Time, t.Valid = parsed, true
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot parse timestamp %q", s)
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"os"
 	"picturebot-backend/internal/model"
 
 	"gorm.io/gorm"
@@ -33,3 +34,42 @@ func (repo *SubFolderRepository) FindByNameAndHierarchyID(name string, hierarchy
 
 	return &subFolder, err
 }
+
+func (repo *SubFolderRepository) FindByID(id uint) (*model.SubFolder, error) {
+	var subFolder model.SubFolder
+	err := repo.db.First(&subFolder, id).Error
+
+	return &subFolder, err
+}
+
+// CountPictures returns the number of pictures stored in a subfolder.
+func (repo *SubFolderRepository) CountPictures(id uint) (int64, error) {
+	var count int64
+	err := repo.db.Model(&model.Picture{}).Where("sub_folder_id = ?", id).Count(&count).Error
+
+	return count, err
+}
+
+// Rename stores a subfolder's new name and location and rewrites the locations of its pictures in one transaction.
+func (repo *SubFolderRepository) Rename(subFolder *model.SubFolder) error {
+	return repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(subFolder).Select("name", "location").Updates(subFolder).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&model.Picture{}).
+			Where("sub_folder_id = ?", subFolder.ID).
+			Update("location", gorm.Expr("? || file_name", subFolder.Location+string(os.PathSeparator))).Error
+	})
+}
+
+func (repo *SubFolderRepository) Delete(subFolder *model.SubFolder) error {
+	return repo.db.Delete(subFolder).Error
+}
+
+func (repo *SubFolderRepository) FindAll() ([]model.SubFolder, error) {
+	var subFolders []model.SubFolder
+	err := repo.db.Find(&subFolders).Error
+
+	return subFolders, err
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"picturebot-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TagRepository struct {
+	db *gorm.DB
+}
+
+func NewTagRepository(db *gorm.DB) *TagRepository {
+	return &TagRepository{db: db}
+}
+
+// FindAll returns every tag ordered by path, so parents come before their children.
+func (r *TagRepository) FindAll() ([]*model.Tag, error) {
+	var tags []*model.Tag
+	err := r.db.Order("path ASC").Find(&tags).Error
+
+	return tags, err
+}
+
+func (r *TagRepository) FindByID(id uint) (*model.Tag, error) {
+	var tag model.Tag
+	err := r.db.First(&tag, id).Error
+
+	return &tag, err
+}
+
+func (r *TagRepository) FindByIDs(ids []uint) ([]model.Tag, error) {
+	var tags []model.Tag
+	err := r.db.Where("id IN ?", ids).Find(&tags).Error
+
+	return tags, err
+}
+
+// EnsurePath returns the tag at the end of names, creating every missing level on the way.
+// Existing levels are matched case-insensitively so "people/bride" reuses "People/Bride".
+func (r *TagRepository) EnsurePath(names []string) (*model.Tag, error) {
+	var leaf *model.Tag
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var parentID *uint
+		parentPath := ""
+		for _, name := range names {
+			path := name
+			if parentID != nil {
+				path = parentPath + model.TagSeparator + name
+			}
+
+			var tags []model.Tag
+			if err := tx.Where("path = ? COLLATE NOCASE", path).Limit(1).Find(&tags).Error; err != nil {
+				return err
+			}
+
+			tag := model.Tag{ParentID: parentID, Name: name, Path: path}
+			if len(tags) > 0 {
+				tag = tags[0]
+			} else if err := tx.Create(&tag).Error; err != nil {
+				return err
+			}
+
+			id := tag.ID
+			parentID = &id
+			parentPath = tag.Path
+			leaf = &tag
+		}
+		return nil
+	})
+
+	return leaf, err
+}
+
+// FindAlbumIDs returns the albums holding pictures tagged with the tag or a tag below it.
+func (r *TagRepository) FindAlbumIDs(tag *model.Tag) ([]uint, error) {
+	var albumIDs []uint
+	err := r.db.Raw(`
+		SELECT DISTINCT sf.hierarchy_id FROM picture_tags pt
+		JOIN tags t ON t.id = pt.tag_id
+		JOIN pictures p ON p.id = pt.picture_id
+		JOIN sub_folders sf ON sf.id = p.sub_folder_id
+		WHERE t.path = ? OR t.path LIKE ? ESCAPE '\'`, tag.Path, likeLiteral(tag.Path)+model.TagSeparator+"%").
+		Scan(&albumIDs).Error
+
+	return albumIDs, err
+}
+
+// DeleteBranch removes a tag, every tag below it and all of their picture assignments.
+func (r *TagRepository) DeleteBranch(tag *model.Tag) (int64, error) {
+	var deleted int64
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		branch := tx.Model(&model.Tag{}).Select("id").
+			Where(`path = ? OR path LIKE ? ESCAPE '\'`, tag.Path, likeLiteral(tag.Path)+model.TagSeparator+"%")
+
+		if err := tx.Exec("DELETE FROM picture_tags WHERE tag_id IN (?)", branch).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where(`path = ? OR path LIKE ? ESCAPE '\'`, tag.Path, likeLiteral(tag.Path)+model.TagSeparator+"%").
+			Delete(&model.Tag{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+
+	return deleted, err
+}
+
+// Assign tags every picture with every tag, ignoring assignments that already exist.
+func (r *TagRepository) Assign(pictureIDs, tagIDs []uint) (int64, error) {
+	type pictureTag struct {
+		PictureID uint
+		TagID     uint
+	}
+
+	rows := make([]pictureTag, 0, len(pictureIDs)*len(tagIDs))
+	for _, p := range pictureIDs {
+		for _, t := range tagIDs {
+			rows = append(rows, pictureTag{PictureID: p, TagID: t})
+		}
+	}
+
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	result := r.db.Table("picture_tags").Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rows, 500)
+	return result.RowsAffected, result.Error
+}
+
+// Unassign removes the given tags from the given pictures.
+func (r *TagRepository) Unassign(pictureIDs, tagIDs []uint) (int64, error) {
+	result := r.db.Exec("DELETE FROM picture_tags WHERE picture_id IN ? AND tag_id IN ?", pictureIDs, tagIDs)
+	return result.RowsAffected, result.Error
+}
+
+// TagCounts holds the number of pictures on a tag itself and on its whole branch.
+type TagCounts struct {
+	Direct int64
+	Total  int64
+}
+
+// CountPictures returns the picture counts of every tag that is used at least once in its branch.
+// Total counts each picture once even when it carries several tags of the branch.
+func (r *TagRepository) CountPictures() (map[uint]TagCounts, error) {
+	var rows []struct {
+		TagID  uint
+		Direct int64
+		Total  int64
+	}
+
+	err := r.db.Raw(`
+		SELECT t.id AS tag_id,
+			COUNT(DISTINCT CASE WHEN d.id = t.id THEN pt.picture_id END) AS direct,
+			COUNT(DISTINCT pt.picture_id) AS total
+		FROM tags t
+		JOIN tags d ON d.path = t.path OR substr(d.path, 1, length(t.path) + 1) = t.path || ?
+		JOIN picture_tags pt ON pt.tag_id = d.id
+		GROUP BY t.id`, model.TagSeparator).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]TagCounts, len(rows))
+	for _, row := range rows {
+		counts[row.TagID] = TagCounts{Direct: row.Direct, Total: row.Total}
+	}
+
+	return counts, nil
+}
+
+// Suggest returns up to limit tags whose name starts with, or whose path contains, the prefix.
+// Name matches and frequently used tags come first.
+func (r *TagRepository) Suggest(prefix string, limit int) ([]*model.Tag, error) {
+	var tags []*model.Tag
+	pattern := likeLiteral(prefix)
+
+	err := r.db.Model(&model.Tag{}).
+		Select(`tags.*, (SELECT COUNT(*) FROM picture_tags pt WHERE pt.tag_id = tags.id) AS picture_count`).
+		Where(`tags.name LIKE ? ESCAPE '\' OR tags.path LIKE ? ESCAPE '\'`, pattern+"%", "%"+pattern+"%").
+		Order(clause.Expr{SQL: `tags.name LIKE ? ESCAPE '\' DESC`, Vars: []any{pattern + "%"}}).
+		Order("picture_count DESC").
+		Order("tags.path ASC").
+		Limit(limit).
+		Find(&tags).Error
+
+	return tags, err
+}
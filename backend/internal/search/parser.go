@@ -0,0 +1,349 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokLParen
+	tokRParen
+	tokNot
+	tokAnd
+	tokOr
+	tokTerm
+)
+
+type token struct {
+	kind tokenKind
+	term Term
+	pos  int
+}
+
+// Parse turns a query string into its syntax tree.
+// An empty query yields a nil Node, which matches every picture.
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, nil
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", describe(tok), tok.pos)
+	}
+
+	return node, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) parseOr() (Node, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []Node{first}
+	for p.peek().kind == tokOr {
+		p.next()
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return Or{Nodes: nodes}, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	var nodes []Node
+	for {
+		switch p.peek().kind {
+		case tokEOF, tokRParen, tokOr:
+			if len(nodes) == 0 {
+				tok := p.peek()
+				return nil, fmt.Errorf("expected a term before %s at position %d", describe(tok), tok.pos)
+			}
+			if len(nodes) == 1 {
+				return nodes[0], nil
+			}
+			return And{Nodes: nodes}, nil
+		case tokAnd:
+			if len(nodes) == 0 {
+				return nil, fmt.Errorf("expected a term before AND at position %d", p.peek().pos)
+			}
+			p.next()
+			continue
+		}
+
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNot:
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: n}, nil
+	case tokLParen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("missing closing parenthesis for position %d", tok.pos)
+		}
+		return n, nil
+	case tokTerm:
+		return tok.term, nil
+	default:
+		return nil, fmt.Errorf("unexpected %s at position %d", describe(tok), tok.pos)
+	}
+}
+
+func describe(tok token) string {
+	switch tok.kind {
+	case tokEOF:
+		return "end of query"
+	case tokLParen:
+		return `"("`
+	case tokRParen:
+		return `")"`
+	case tokNot:
+		return "NOT"
+	case tokAnd:
+		return "AND"
+	case tokOr:
+		return "OR"
+	default:
+		return "term " + tok.term.String()
+	}
+}
+
+// lex splits the input into tokens, validating each field term as it goes.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	i := 0
+
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, pos: i})
+			i++
+		case r == '-':
+			tokens = append(tokens, token{kind: tokNot, pos: i})
+			i++
+		default:
+			start := i
+			tok, next, err := lexTerm(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tok.pos = start
+			tokens = append(tokens, tok)
+			i = next
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(runes)}), nil
+}
+
+func lexTerm(runes []rune, i int) (token, int, error) {
+	start := i
+
+	// A field name is a run of letters directly followed by an operator
+	for i < len(runes) && unicode.IsLetter(runes[i]) {
+		i++
+	}
+
+	if i > start && i < len(runes) {
+		if op, width := readOp(runes[i:]); width > 0 {
+			field := strings.ToLower(string(runes[start:i]))
+			value, next, err := readValue(runes, i+width)
+			if err != nil {
+				return token{}, 0, err
+			}
+
+			term := Term{Field: field, Op: op, Value: value}
+			if err := validateTerm(term); err != nil {
+				return token{}, 0, fmt.Errorf("%w at position %d", err, start)
+			}
+			return token{kind: tokTerm, term: term}, next, nil
+		}
+	}
+
+	value, next, err := readValue(runes, start)
+	if err != nil {
+		return token{}, 0, err
+	}
+
+	// Keywords are only recognised when unquoted
+	if runes[start] != '"' {
+		switch value {
+		case "AND":
+			return token{kind: tokAnd}, next, nil
+		case "OR":
+			return token{kind: tokOr}, next, nil
+		case "NOT":
+			return token{kind: tokNot}, next, nil
+		}
+	}
+
+	return token{kind: tokTerm, term: Term{Op: OpEq, Value: value}}, next, nil
+}
+
+func readOp(runes []rune) (Op, int) {
+	switch runes[0] {
+	case ':', '=':
+		return OpEq, 1
+	case '>':
+		if len(runes) > 1 && runes[1] == '=' {
+			return OpGte, 2
+		}
+		return OpGt, 1
+	case '<':
+		if len(runes) > 1 && runes[1] == '=' {
+			return OpLte, 2
+		}
+		return OpLt, 1
+	}
+	return "", 0
+}
+
+// readValue reads either a double-quoted string or a run of characters up to whitespace or a parenthesis.
+func readValue(runes []rune, i int) (string, int, error) {
+	if i < len(runes) && runes[i] == '"' {
+		var sb strings.Builder
+		for j := i + 1; j < len(runes); j++ {
+			switch runes[j] {
+			case '\\':
+				if j+1 < len(runes) {
+					j++
+					sb.WriteRune(runes[j])
+				}
+			case '"':
+				return sb.String(), j + 1, nil
+			default:
+				sb.WriteRune(runes[j])
+			}
+		}
+		return "", 0, fmt.Errorf("unterminated quote at position %d", i)
+	}
+
+	start := i
+	for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+		i++
+	}
+
+	if i == start {
+		return "", 0, fmt.Errorf("missing value at position %d", start)
+	}
+
+	return string(runes[start:i]), i, nil
+}
+
+func validateTerm(t Term) error {
+	kind, ok := Fields[t.Field]
+	if !ok {
+		return fmt.Errorf("unknown field %q", t.Field)
+	}
+
+	switch kind {
+	case KindText:
+		if t.Op != OpEq {
+			return fmt.Errorf("field %q only supports \":\"", t.Field)
+		}
+	case KindInt:
+		if _, err := strconv.Atoi(t.Value); err != nil {
+			return fmt.Errorf("field %q expects a whole number, got %q", t.Field, t.Value)
+		}
+	case KindFloat:
+		if _, err := strconv.ParseFloat(t.Value, 64); err != nil {
+			return fmt.Errorf("field %q expects a number, got %q", t.Field, t.Value)
+		}
+	case KindDate:
+		if _, _, err := DateRange(t.Value); err != nil {
+			return fmt.Errorf("field %q: %w", t.Field, err)
+		}
+	}
+
+	return nil
+}
+
+var dateLayouts = []string{"2006-01-02", "2006-01", "2006"}
+
+// DateRange expands a year, month or day value into the half-open range [start, end) in local time.
+func DateRange(value string) (time.Time, time.Time, error) {
+	for _, layout := range dateLayouts {
+		if len(value) != len(layout) {
+			continue
+		}
+
+		start, err := time.ParseInLocation(layout, value, time.Local)
+		if err != nil {
+			continue
+		}
+
+		switch layout {
+		case "2006":
+			return start, start.AddDate(1, 0, 0), nil
+		case "2006-01":
+			return start, start.AddDate(0, 1, 0), nil
+		default:
+			return start, start.AddDate(0, 0, 1), nil
+		}
+	}
+
+	return time.Time{}, time.Time{}, errors.New("date must look like 2025, 2025-06 or 2025-06-14")
+}
@@ -0,0 +1,120 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string // The parsed tree as printed by String, empty for a nil node
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"beach", `"beach"`},
+		{`rating>=4 camera:"ILCE-7M4"`, `(rating>="4" AND camera:"ILCE-7M4")`},
+		{"iso<800 aperture<=2.8 focal>50", `(iso<"800" AND aperture<="2.8" AND focal>"50")`},
+		{"Album=Wed*", `album:"Wed*"`},
+		{"camera:ILCE-7M4", `camera:"ILCE-7M4"`},
+		{"taken:2025-06", `taken:"2025-06"`},
+		{"attr:venue=*hall*", `attr:"venue=*hall*"`},
+		{"tag:Places/Belgium", `tag:"Places/Belgium"`},
+		{`file:"a \"b\""`, `file:"a \"b\""`},
+		{`"AND"`, `"AND"`},
+
+		// AND binds tighter than OR, NOT and "-" bind to the next term or group
+		{"a AND b", `("a" AND "b")`},
+		{"a b OR c", `(("a" AND "b") OR "c")`},
+		{"a OR b c", `("a" OR ("b" AND "c"))`},
+		{"a (b OR c)", `("a" AND ("b" OR "c"))`},
+		{"-type:raw", `(NOT type:"raw")`},
+		{"NOT a b", `((NOT "a") AND "b")`},
+		{"-(a OR b)", `(NOT ("a" OR "b"))`},
+		{"((a))", `"a"`},
+	}
+
+	for _, tt := range tests {
+		node, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.input, err)
+			continue
+		}
+
+		got := ""
+		if node != nil {
+			got = node.String()
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string // Part of the expected error message
+	}{
+		{"unknown:x", `unknown field "unknown"`},
+		{"rating:high", "expects a whole number"},
+		{"aperture:f2", "expects a number"},
+		{"camera>5", `only supports ":"`},
+		{"taken:2025-6", "date must look like"},
+		{`file:"open`, "unterminated quote at position 5"},
+		{"rating:", "missing value at position 7"},
+		{"(a OR b", "missing closing parenthesis"},
+		{"a)", `unexpected ")" at position 1`},
+		{"()", `expected a term before ")"`},
+		{"OR a", "expected a term before OR"},
+		{"a OR", "expected a term before end of query"},
+		{"AND a", "expected a term before AND"},
+		{"-", "unexpected end of query"},
+	}
+
+	for _, tt := range tests {
+		node, err := Parse(tt.input)
+		if err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", tt.input, node)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error %q, want it to contain %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestDateRange(t *testing.T) {
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		value      string
+		start, end time.Time
+	}{
+		{"2025", day(2025, 1, 1), day(2026, 1, 1)},
+		{"2025-06", day(2025, 6, 1), day(2025, 7, 1)},
+		{"2025-12", day(2025, 12, 1), day(2026, 1, 1)},
+		{"2025-06-14", day(2025, 6, 14), day(2025, 6, 15)},
+		{"2024-02-29", day(2024, 2, 29), day(2024, 3, 1)},
+	}
+
+	for _, tt := range tests {
+		start, end, err := DateRange(tt.value)
+		if err != nil {
+			t.Errorf("DateRange(%q) error: %v", tt.value, err)
+			continue
+		}
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("DateRange(%q) = [%v, %v), want [%v, %v)", tt.value, start, end, tt.start, tt.end)
+		}
+	}
+
+	for _, value := range []string{"", "25", "2025-6", "2025-13", "2025-02-30", "2025/06", "June 2025"} {
+		if _, _, err := DateRange(value); err == nil {
+			t.Errorf("DateRange(%q) succeeded, want an error", value)
+		}
+	}
+}
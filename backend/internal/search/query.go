@@ -0,0 +1,114 @@
+// Package search parses the picture search language used by GET /pictures/search.
+//
+// A query is a list of terms that must all match, for example:
+//
+//	rating>=4 camera:"ILCE-7M4" iso<800 taken:2025-06 album:"Wedding*" type:raw
+//
+// Terms can be combined with OR, negated with a leading "-" or NOT and grouped
+// with parentheses. A word without a field name matches the file name.
+//
+// Album details can be searched as well, for example:
+//
+//	client:"Acme*" event:2025-06 location:Ghent attr:venue=*hall*
+//
+// attr takes either key=value or just a key to match albums that have the attribute.
+// tag:Places/Belgium matches pictures tagged with that keyword or any keyword below it.
+package search
+
+import "fmt"
+
+// Op is the comparison between a field and its value.
+type Op string
+
+const (
+	OpEq  Op = ":"
+	OpGt  Op = ">"
+	OpGte Op = ">="
+	OpLt  Op = "<"
+	OpLte Op = "<="
+)
+
+// Kind describes how the value of a field is interpreted.
+type Kind int
+
+const (
+	KindText Kind = iota
+	KindInt
+	KindFloat
+	KindDate
+)
+
+// Fields lists the searchable field names and the kind of value they take.
+var Fields = map[string]Kind{
+	"rating":   KindInt,
+	"iso":      KindInt,
+	"aperture": KindFloat,
+	"focal":    KindFloat,
+	"camera":   KindText,
+	"lens":     KindText,
+	"album":    KindText,
+	"folder":   KindText,
+	"file":     KindText,
+	"type":     KindText,
+	"ext":      KindText,
+	"taken":    KindDate,
+	"tag":      KindText,
+
+	// Album details
+	"description": KindText,
+	"location":    KindText,
+	"client":      KindText,
+	"contact":     KindText,
+	"attr":        KindText,
+	"event":       KindDate,
+}
+
+// Node is an element of a parsed query.
+type Node interface {
+	String() string
+}
+
+// And matches when every child matches.
+type And struct {
+	Nodes []Node
+}
+
+// Or matches when at least one child matches.
+type Or struct {
+	Nodes []Node
+}
+
+// Not matches when its child does not.
+type Not struct {
+	Node Node
+}
+
+// Term compares a single field with a value. Text values may contain "*" and "?" wildcards.
+// An empty Field means free text matched against the file name.
+type Term struct {
+	Field string
+	Op    Op
+	Value string
+}
+
+func (n And) String() string { return joinNodes("AND", n.Nodes) }
+func (n Or) String() string  { return joinNodes("OR", n.Nodes) }
+func (n Not) String() string { return fmt.Sprintf("(NOT %s)", n.Node) }
+
+func (t Term) String() string {
+	if t.Field == "" {
+		return fmt.Sprintf("%q", t.Value)
+	}
+	return fmt.Sprintf("%s%s%q", t.Field, t.Op, t.Value)
+}
+
+func joinNodes(op string, nodes []Node) string {
+	s := "("
+	for i, n := range nodes {
+		if i > 0 {
+			s += " " + op + " "
+		}
+		s += n.String()
+	}
+	return s + ")"
+}
@@ -0,0 +1,719 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"picturebot-backend/internal/events"
+	"picturebot-backend/internal/model"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// shot is one exposure: the RAW and JPG files that share an index inside an album.
+type shot struct {
+	Index    string
+	Time     time.Time
+	Pictures []*model.Picture
+}
+
+// relocation moves a single picture file to a new path on disk.
+type relocation struct {
+	PictureID uint
+	From      string
+	To        string
+}
+
+// MergeAlbums moves every picture of the source album into the target album, interleaving both
+// albums chronologically and re-indexing the result. The emptied source album is deleted afterwards.
+func (s *HierarchyService) MergeAlbums(targetID, sourceID uint) (*model.Hierarchy, error) {
+	if targetID == sourceID {
+		return nil, fmt.Errorf("%w: an album cannot be merged into itself", ErrInvalidUpdate)
+	}
+
+	target, err := s.loadAlbum(targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := s.loadAlbum(sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	subFolderNames := subFolderNameMap(target, source)
+
+	shots := append(groupShots(target), groupShots(source)...)
+	sort.SliceStable(shots, func(i, j int) bool {
+		return shots[i].Time.Before(shots[j].Time)
+	})
+
+	moves, pictures, err := s.planRelocation(target, shots, subFolderNames, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyRelocation(moves, pictures); err != nil {
+		slog.Error("Merge failed", "target", target.Name, "source", source.Name, "error", err)
+		return nil, err
+	}
+
+	if err := s.repo.DeleteSubtree([]uint{source.ID}); err != nil {
+		slog.Error("Service error: failed to delete merged source album", "id", source.ID, "error", err)
+		return nil, fmt.Errorf("pictures merged but deleting the source album failed: %w", err)
+	}
+
+	if err := removeAlbumDir(source); err != nil {
+		slog.Warn("IO warning: failed to remove merged source album directory", "album", source.Name, "error", err)
+	}
+
+	slog.Info("Albums merged", "target", target.Name, "source", source.Name, "shots", len(shots), "pictures", len(pictures))
+	s.writeManifests(target.ID)
+	s.broker.Publish(events.NodeDeleted, DeletedNodes{ID: source.ID, IDs: []uint{source.ID}})
+	s.publishNodes(events.NodeUpdated, target.ID)
+
+	return s.reloadAlbum(target.ID)
+}
+
+// reloadAlbum returns the stored state of an album after an operation changed it.
+func (s *HierarchyService) reloadAlbum(id uint) (*model.Hierarchy, error) {
+	album, err := s.repo.FindByIDWithPictures(id)
+	if err != nil {
+		slog.Error("Service error: failed to reload album", "id", id, "error", err)
+		return nil, err
+	}
+
+	album.Children = []*model.Hierarchy{}
+	return album, nil
+}
+
+// loadAlbum fetches an album with its subfolders and pictures, rejecting other node types.
+func (s *HierarchyService) loadAlbum(id uint) (*model.Hierarchy, error) {
+	node, err := s.repo.FindByIDWithPictures(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNodeNotFound
+		}
+		slog.Error("Service error: failed to load album", "id", id, "error", err)
+		return nil, err
+	}
+
+	if node.Type != model.TypeAlbum {
+		return nil, fmt.Errorf("%w: node %d is not an album", ErrInvalidUpdate, id)
+	}
+
+	return node, nil
+}
+
+// subFolderNameMap indexes the subfolder names of the given albums by subfolder ID.
+func subFolderNameMap(albums ...*model.Hierarchy) map[uint]string {
+	names := make(map[uint]string)
+	for _, album := range albums {
+		for _, sf := range album.SubFolders {
+			names[sf.ID] = sf.Name
+		}
+	}
+	return names
+}
+
+// groupShots collects an album's pictures into shots ordered by their current index.
+func groupShots(album *model.Hierarchy) []*shot {
+	byIndex := make(map[string]*shot)
+	var shots []*shot
+
+	for i := range album.SubFolders {
+		for j := range album.SubFolders[i].Pictures {
+			pic := &album.SubFolders[i].Pictures[j]
+
+			sh, ok := byIndex[pic.Index]
+			if !ok {
+				sh = &shot{Index: pic.Index}
+				byIndex[pic.Index] = sh
+				shots = append(shots, sh)
+			}
+			sh.Pictures = append(sh.Pictures, pic)
+		}
+	}
+
+	for _, sh := range shots {
+		sh.Time = shotTime(sh)
+	}
+
+	sort.SliceStable(shots, func(i, j int) bool {
+		return shots[i].Index < shots[j].Index
+	})
+
+	return shots
+}
+
+// shotTime prefers the RAW capture time, like getGroupTime does during import.
+func shotTime(sh *shot) time.Time {
+	var fallback *time.Time
+	for _, p := range sh.Pictures {
+		if p.CapturedAt == nil {
+			continue
+		}
+		if p.Type == "raw" {
+			return *p.CapturedAt
+		}
+		if fallback == nil {
+			fallback = p.CapturedAt
+		}
+	}
+
+	if fallback != nil {
+		return *fallback
+	}
+	return time.Time{}
+}
+
+// planRelocation assigns consecutive indices starting at firstIndex to the shots and points every picture
+// at the target album subfolder with the same name as its current one, creating missing subfolders.
+// The pictures are updated in memory; the returned relocations describe the matching disk moves.
+func (s *HierarchyService) planRelocation(target *model.Hierarchy, shots []*shot, subFolderNames map[uint]string, firstIndex int) ([]relocation, []*model.Picture, error) {
+	targetFolders := make(map[string]*model.SubFolder)
+	for i := range target.SubFolders {
+		targetFolders[target.SubFolders[i].Name] = &target.SubFolders[i]
+	}
+
+	var moves []relocation
+	var pictures []*model.Picture
+
+	for i, sh := range shots {
+		newIndex := fmt.Sprintf("%06d", firstIndex+i)
+
+		for _, pic := range sh.Pictures {
+			folderName := subFolderNames[pic.SubFolderID]
+
+			dest, ok := targetFolders[folderName]
+			if !ok {
+				created, err := s.addSubFolder(target, folderName)
+				if err != nil {
+					return nil, nil, err
+				}
+				targetFolders[folderName] = created
+				dest = created
+			}
+
+			newFileName := newIndex + pic.Extension
+			moves = append(moves, relocation{
+				PictureID: pic.ID,
+				From:      pic.Location,
+				To:        filepath.Join(dest.Location, newFileName),
+			})
+
+			pic.Index = newIndex
+			pic.FileName = newFileName
+			pic.Location = filepath.Join(dest.Location, newFileName)
+			pic.SubFolderID = dest.ID
+			pictures = append(pictures, pic)
+		}
+	}
+
+	return moves, pictures, nil
+}
+
+// addSubFolder creates a named subfolder row and directory inside an album.
+func (s *HierarchyService) addSubFolder(album *model.Hierarchy, name string) (*model.SubFolder, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: picture is not in a known subfolder", ErrInvalidUpdate)
+	}
+
+	sub := &model.SubFolder{
+		Name:        name,
+		Location:    filepath.Join(libraryRoot, album.UUID, name),
+		HierarchyID: album.ID,
+	}
+
+	if err := os.MkdirAll(sub.Location, 0755); err != nil {
+		slog.Error("IO error: failed to create subfolder", "path", sub.Location, "error", err)
+		return nil, fmt.Errorf("failed to create subfolder %s: %w", name, err)
+	}
+
+	if err := s.subFolderRepo.Create(sub); err != nil {
+		slog.Error("Service error: failed to save subfolder", "album", album.Name, "name", name, "error", err)
+		return nil, err
+	}
+
+	album.SubFolders = append(album.SubFolders, *sub)
+	return sub, nil
+}
+
+// applyRelocation performs the disk moves and then stores the new picture rows.
+// If the database update fails the files are moved back so disk and catalog stay in sync.
+// The album watcher ignores the moved paths until the rows are stored.
+func (s *HierarchyService) applyRelocation(moves []relocation, pictures []*model.Picture) error {
+	paths := make([]string, 0, 2*len(moves))
+	for _, m := range moves {
+		paths = append(paths, m.From, m.To)
+	}
+	release := ownChanges.hold(paths...)
+	defer release()
+
+	undo, err := relocateFiles(moves)
+	if err != nil {
+		return err
+	}
+
+	if err := s.pictureRepo.UpdateFiles(pictures); err != nil {
+		slog.Error("Service error: failed to update moved pictures, restoring files", "error", err)
+		undo()
+		return err
+	}
+
+	return nil
+}
+
+// relocateFiles moves files in two passes through temporary names, so renumbering inside one
+// folder never overwrites a file that still has to move. It returns a function that reverts the moves.
+func relocateFiles(moves []relocation) (func(), error) {
+	temps := make([]string, len(moves))
+	staged := 0
+	placed := 0
+
+	undo := func() {
+		for i := placed - 1; i >= 0; i-- {
+			if err := os.Rename(moves[i].To, temps[i]); err != nil {
+				slog.Error("IO error: failed to restore file", "path", moves[i].To, "error", err)
+			}
+		}
+		for i := staged - 1; i >= 0; i-- {
+			if err := os.Rename(temps[i], moves[i].From); err != nil {
+				slog.Error("IO error: failed to restore file", "path", moves[i].From, "error", err)
+			}
+		}
+	}
+
+	for i, m := range moves {
+		if err := os.MkdirAll(filepath.Dir(m.To), 0755); err != nil {
+			undo()
+			return nil, fmt.Errorf("failed to create %s: %w", filepath.Dir(m.To), err)
+		}
+
+		temps[i] = filepath.Join(filepath.Dir(m.To), fmt.Sprintf(".picturebot-move-%d%s", m.PictureID, filepath.Ext(m.To)))
+		if err := os.Rename(m.From, temps[i]); err != nil {
+			undo()
+			return nil, fmt.Errorf("failed to move %s: %w", m.From, err)
+		}
+		staged++
+	}
+
+	for i, m := range moves {
+		if _, err := os.Stat(m.To); err == nil {
+			undo()
+			return nil, fmt.Errorf("refusing to overwrite untracked file %s", m.To)
+		}
+
+		if err := os.Rename(temps[i], m.To); err != nil {
+			undo()
+			return nil, fmt.Errorf("failed to move %s: %w", m.From, err)
+		}
+		placed++
+	}
+
+	return undo, nil
+}
+
+// removeAlbumDir deletes an album's directory once it holds no files,
+// and moves it to the library trash when untracked files are left behind.
+func removeAlbumDir(album *model.Hierarchy) error {
+	if album.UUID == "" {
+		return nil
+	}
+
+	return removeDir(filepath.Join(libraryRoot, album.UUID))
+}
+
+// removeDir deletes a directory tree that holds no files and moves it to the library trash otherwise.
+func removeDir(dir string) error {
+	hasFiles := false
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// The manifest of a removed album describes nothing anymore
+		if !d.IsDir() && d.Name() != manifestFile {
+			hasFiles = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if hasFiles {
+		_, err := moveToTrash(dir)
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// MovePictures moves the given pictures into the target album. Each picture brings the other files of
+// its shot along so RAW/JPG pairs stay together. Moved shots are appended after the album's last index.
+func (s *HierarchyService) MovePictures(targetID uint, pictureIDs []uint) (*model.Hierarchy, error) {
+	if len(pictureIDs) == 0 {
+		return nil, fmt.Errorf("%w: picture_ids must not be empty", ErrInvalidUpdate)
+	}
+
+	target, err := s.loadAlbum(targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := s.pictureRepo.FindByIDs(pictureIDs)
+	if err != nil {
+		slog.Error("Service error: failed to load pictures to move", "error", err)
+		return nil, err
+	}
+
+	selected := make(map[uint]bool, len(found))
+	var sourceIDs []uint
+	for _, p := range found {
+		if p.SubFolder.HierarchyID == target.ID {
+			return nil, fmt.Errorf("%w: picture %d is already in this album", ErrInvalidUpdate, p.ID)
+		}
+		if !slices.Contains(sourceIDs, p.SubFolder.HierarchyID) {
+			sourceIDs = append(sourceIDs, p.SubFolder.HierarchyID)
+		}
+		selected[p.ID] = true
+	}
+
+	for _, id := range pictureIDs {
+		if !selected[id] {
+			return nil, fmt.Errorf("%w: %d", ErrPictureNotFound, id)
+		}
+	}
+
+	albums := []*model.Hierarchy{target}
+	var shots []*shot
+	for _, id := range sourceIDs {
+		source, err := s.loadAlbum(id)
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, source)
+
+		for _, sh := range groupShots(source) {
+			if shotSelected(sh, selected) {
+				shots = append(shots, sh)
+			}
+		}
+	}
+
+	sort.SliceStable(shots, func(i, j int) bool {
+		return shots[i].Time.Before(shots[j].Time)
+	})
+
+	moves, pictures, err := s.planRelocation(target, shots, subFolderNameMap(albums...), nextIndex(target))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyRelocation(moves, pictures); err != nil {
+		slog.Error("Moving pictures failed", "target", target.Name, "error", err)
+		return nil, err
+	}
+
+	slog.Info("Pictures moved", "target", target.Name, "shots", len(shots), "pictures", len(pictures))
+	s.writeManifests(append([]uint{target.ID}, sourceIDs...)...)
+	s.publishNodes(events.NodeUpdated, append([]uint{target.ID}, sourceIDs...)...)
+
+	return s.reloadAlbum(target.ID)
+}
+
+// nextIndex returns the number following the highest picture index in an album.
+func nextIndex(album *model.Hierarchy) int {
+	highest := 0
+	for _, sf := range album.SubFolders {
+		for _, p := range sf.Pictures {
+			if n, err := strconv.Atoi(p.Index); err == nil && n > highest {
+				highest = n
+			}
+		}
+	}
+	return highest + 1
+}
+
+const (
+	SplitByDay       = "day"
+	SplitByGap       = "gap"
+	SplitBySelection = "selection"
+)
+
+type SplitAlbumRequest struct {
+	Mode       string `json:"mode"`        // "day", "gap" or "selection"
+	GapMinutes int    `json:"gap_minutes"` // Minimum pause between two shots that starts a new album in gap mode
+	PictureIDs []uint `json:"picture_ids"` // Pictures to split off in selection mode, their RAW/JPG partners follow them
+	Name       string `json:"name"`        // Name of the new album in selection mode, base name in the other modes
+}
+
+// SplitAlbum divides an album into several albums. The first group stays in the original album,
+// every other group gets a new sibling album with its own UUID directory. Indices restart in each album.
+func (s *HierarchyService) SplitAlbum(id uint, req SplitAlbumRequest) ([]*model.Hierarchy, error) {
+	album, err := s.loadAlbum(id)
+	if err != nil {
+		return nil, err
+	}
+
+	shots := groupShots(album)
+	sort.SliceStable(shots, func(i, j int) bool {
+		return shots[i].Time.Before(shots[j].Time)
+	})
+
+	groups, names, err := splitShots(album, shots, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(groups) < 2 {
+		return nil, fmt.Errorf("%w: the album would not be split into more than one part", ErrInvalidUpdate)
+	}
+
+	// The names given and the ones derived from them follow the same rules as any other album
+	for _, name := range names {
+		if fe := validateNodeName(name); fe != nil {
+			return nil, &ValidationError{Fields: []FieldError{*fe}}
+		}
+	}
+
+	for _, name := range names {
+		exists, err := s.repo.FindDuplicate(album.ParentID, name, model.TypeAlbum, 0)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateName, name)
+		}
+	}
+
+	subFolderNames := subFolderNameMap(album)
+
+	var created []*model.Hierarchy
+	cleanup := func() {
+		for _, n := range created {
+			if err := s.repo.DeleteSubtree([]uint{n.ID}); err != nil {
+				slog.Error("Service error: failed to remove album after failed split", "id", n.ID, "error", err)
+			}
+			if err := removeAlbumDir(n); err != nil {
+				slog.Warn("IO warning: failed to remove album directory after failed split", "album", n.Name, "error", err)
+			}
+		}
+	}
+
+	moves, pictures, err := s.planRelocation(album, groups[0], subFolderNames, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, group := range groups[1:] {
+		newAlbum, err := s.createAlbumNode(album.ParentID, names[i])
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		created = append(created, newAlbum)
+
+		// Give the new album the same layout as the original
+		for _, sf := range album.SubFolders {
+			if _, err := s.addSubFolder(newAlbum, sf.Name); err != nil {
+				cleanup()
+				return nil, err
+			}
+		}
+
+		groupMoves, groupPictures, err := s.planRelocation(newAlbum, group, subFolderNames, 1)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		moves = append(moves, groupMoves...)
+		pictures = append(pictures, groupPictures...)
+	}
+
+	if err := s.applyRelocation(moves, pictures); err != nil {
+		slog.Error("Split failed", "album", album.Name, "error", err)
+		cleanup()
+		return nil, err
+	}
+
+	slog.Info("Album split", "album", album.Name, "mode", req.Mode, "parts", len(groups))
+	s.writeManifests(append([]uint{album.ID}, nodeIDs(created)...)...)
+	s.publishNodes(events.NodeCreated, nodeIDs(created)...)
+	s.publishNodes(events.NodeUpdated, album.ID)
+
+	result := make([]*model.Hierarchy, 0, len(groups))
+	for _, id := range append([]uint{album.ID}, nodeIDs(created)...) {
+		reloaded, err := s.reloadAlbum(id)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, reloaded)
+	}
+
+	return result, nil
+}
+
+// splitShots partitions chronologically sorted shots according to the split mode.
+// It returns the groups and the names for every group except the first, which stays in the original album.
+func splitShots(album *model.Hierarchy, shots []*shot, req SplitAlbumRequest) ([][]*shot, []string, error) {
+	baseName := strings.TrimSpace(req.Name)
+	if baseName == "" {
+		baseName = album.Name
+	}
+
+	var groups [][]*shot
+	var names []string
+
+	switch req.Mode {
+	case SplitByDay:
+		var current string
+		for _, sh := range shots {
+			day := ""
+			if !sh.Time.IsZero() {
+				day = sh.Time.Local().Format("2006-01-02")
+			}
+
+			if len(groups) == 0 || (day != current && day != "") {
+				groups = append(groups, nil)
+				if len(groups) > 1 {
+					names = append(names, fmt.Sprintf("%s %s", baseName, day))
+				}
+				current = day
+			}
+			groups[len(groups)-1] = append(groups[len(groups)-1], sh)
+		}
+
+	case SplitByGap:
+		if req.GapMinutes <= 0 {
+			return nil, nil, fmt.Errorf("%w: gap_minutes must be greater than zero", ErrInvalidUpdate)
+		}
+		gap := time.Duration(req.GapMinutes) * time.Minute
+
+		var last time.Time
+		for _, sh := range shots {
+			if len(groups) == 0 || (!last.IsZero() && sh.Time.Sub(last) > gap) {
+				groups = append(groups, nil)
+				if len(groups) > 1 {
+					names = append(names, fmt.Sprintf("%s - part %d", baseName, len(groups)))
+				}
+			}
+			groups[len(groups)-1] = append(groups[len(groups)-1], sh)
+			if !sh.Time.IsZero() {
+				last = sh.Time
+			}
+		}
+
+	case SplitBySelection:
+		if len(req.PictureIDs) == 0 {
+			return nil, nil, fmt.Errorf("%w: picture_ids must not be empty", ErrInvalidUpdate)
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			return nil, nil, fmt.Errorf("%w: a name for the new album is required", ErrInvalidUpdate)
+		}
+
+		inAlbum := make(map[uint]bool)
+		for _, sh := range shots {
+			for _, p := range sh.Pictures {
+				inAlbum[p.ID] = true
+			}
+		}
+
+		selected := make(map[uint]bool, len(req.PictureIDs))
+		for _, id := range req.PictureIDs {
+			if !inAlbum[id] {
+				return nil, nil, fmt.Errorf("%w: picture %d is not in this album", ErrInvalidUpdate, id)
+			}
+			selected[id] = true
+		}
+
+		var kept, moved []*shot
+		for _, sh := range shots {
+			if shotSelected(sh, selected) {
+				moved = append(moved, sh)
+			} else {
+				kept = append(kept, sh)
+			}
+		}
+
+		if len(kept) == 0 {
+			return nil, nil, fmt.Errorf("%w: the selection must leave at least one picture in the album", ErrInvalidUpdate)
+		}
+
+		groups = [][]*shot{kept, moved}
+		names = []string{baseName}
+
+	default:
+		return nil, nil, fmt.Errorf("%w: mode must be one of day, gap or selection", ErrInvalidUpdate)
+	}
+
+	return groups, names, nil
+}
+
+func shotSelected(sh *shot, selected map[uint]bool) bool {
+	for _, p := range sh.Pictures {
+		if selected[p.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+// createAlbumNode stores a new, empty album and creates its UUID directory.
+func (s *HierarchyService) createAlbumNode(parentID *uint, name string) (*model.Hierarchy, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		slog.Error("Service error: failed to generate UUID", "error", err)
+		return nil, fmt.Errorf("failed to generate UUID: %w", err)
+	}
+
+	position, err := s.repo.NextPosition(parentID)
+	if err != nil {
+		slog.Error("Service error: failed to determine node position", "name", name, "error", err)
+		return nil, err
+	}
+
+	album := &model.Hierarchy{
+		ParentID: parentID,
+		Name:     name,
+		Type:     model.TypeAlbum,
+		UUID:     id.String(),
+		Position: position,
+		Children: []*model.Hierarchy{},
+	}
+
+	albumRoot := filepath.Join(libraryRoot, album.UUID)
+	if err := os.MkdirAll(albumRoot, 0755); err != nil {
+		slog.Error("IO error: failed to create album directory", "path", albumRoot, "error", err)
+		return nil, fmt.Errorf("failed to create album directory: %w", err)
+	}
+
+	if err := s.repo.Create(album); err != nil {
+		slog.Error("Service error: failed to save album", "name", name, "error", err)
+		return nil, err
+	}
+
+	return album, nil
+}
+
+func nodeIDs(nodes []*model.Hierarchy) []uint {
+	ids := make([]uint, 0, len(nodes))
+	for _, n := range nodes {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
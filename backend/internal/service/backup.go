@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/repository"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	backupPollInterval = 10 * time.Minute // How often the schedule is checked
+	backupPrefix       = "picturebot-"
+	backupExt          = ".db"
+	backupTimeLayout   = "20060102-150405"
+)
+
+// BackupService writes snapshots of the catalog database on a schedule and on request,
+// and removes the oldest ones beyond the configured retention.
+type BackupService struct {
+	repo         *repository.BackupRepository
+	settingsRepo *repository.SettingsRepository
+	dbPath       string
+
+	mu sync.Mutex // Serialises snapshots and pruning
+}
+
+func NewBackupService(repo *repository.BackupRepository, settingsRepo *repository.SettingsRepository, dbPath string) *BackupService {
+	return &BackupService{
+		repo:         repo,
+		settingsRepo: settingsRepo,
+		dbPath:       dbPath,
+	}
+}
+
+// Backup describes one snapshot file.
+type Backup struct {
+	Name          string    `json:"name"`
+	Path          string    `json:"path"`
+	Size          int64     `json:"size"`
+	CreatedAt     time.Time `json:"created_at"`
+	SchemaVersion int       `json:"schema_version,omitempty"` // Only known for snapshots taken by this run
+}
+
+// Run takes a snapshot whenever the newest one is older than the configured interval,
+// until ctx is cancelled.
+func (s *BackupService) Run(ctx context.Context) {
+	ticker := time.NewTicker(backupPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.backupIfDue(); err != nil {
+			slog.Error("Service error: scheduled backup failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *BackupService) backupIfDue() error {
+	settings, err := s.settingsRepo.GetSettings()
+	if err != nil {
+		return err
+	}
+	if settings.BackupIntervalHours <= 0 {
+		return nil
+	}
+
+	backups, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	interval := time.Duration(settings.BackupIntervalHours) * time.Hour
+	if len(backups) > 0 && time.Since(backups[0].CreatedAt) < interval {
+		return nil
+	}
+
+	_, err = s.Backup()
+	return err
+}
+
+// Backup writes a snapshot now and prunes the old ones.
+func (s *BackupService) Backup() (*Backup, error) {
+	settings, err := s.settingsRepo.GetSettings()
+	if err != nil {
+		slog.Error("Service error: failed to load settings", "error", err)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := s.backupDir(settings)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		slog.Error("IO error: failed to create backup directory", "path", dir, "error", err)
+		return nil, err
+	}
+
+	version, err := s.repo.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	name := backupPrefix + now.Format(backupTimeLayout) + backupExt
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("backup %s already exists", name)
+	}
+
+	// The snapshot is written under a temporary name so a half written file is never listed
+	tmp := path + ".tmp"
+	_ = os.Remove(tmp)
+	if err := s.repo.Snapshot(tmp); err != nil {
+		slog.Error("Service error: database snapshot failed", "path", path, "error", err)
+		_ = os.Remove(tmp)
+		return nil, fmt.Errorf("database snapshot failed: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		slog.Error("IO error: failed to store database snapshot", "path", path, "error", err)
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Database backed up", "path", path, "bytes", info.Size(), "schema_version", version)
+	s.prune(dir, settings.BackupKeep)
+
+	return &Backup{Name: name, Path: path, Size: info.Size(), CreatedAt: now, SchemaVersion: version}, nil
+}
+
+// List returns the snapshots in the backup directory, newest first.
+func (s *BackupService) List() ([]Backup, error) {
+	settings, err := s.settingsRepo.GetSettings()
+	if err != nil {
+		slog.Error("Service error: failed to load settings", "error", err)
+		return nil, err
+	}
+
+	backups, err := listBackups(s.backupDir(settings))
+	if errors.Is(err, os.ErrNotExist) {
+		return []Backup{}, nil
+	}
+	return backups, err
+}
+
+// prune removes the oldest snapshots beyond keep, 0 keeps every snapshot. The caller holds s.mu.
+func (s *BackupService) prune(dir string, keep int) {
+	if keep <= 0 {
+		return
+	}
+
+	backups, err := listBackups(dir)
+	if err != nil {
+		slog.Warn("IO warning: failed to list backups for pruning", "path", dir, "error", err)
+		return
+	}
+
+	for _, b := range backups[min(keep, len(backups)):] {
+		if err := os.Remove(b.Path); err != nil {
+			slog.Warn("IO warning: failed to remove old backup", "path", b.Path, "error", err)
+			continue
+		}
+		slog.Info("Old backup removed", "path", b.Path)
+	}
+}
+
+func (s *BackupService) backupDir(settings *model.Settings) string {
+	if settings.BackupDir != "" {
+		return settings.BackupDir
+	}
+	return filepath.Join(filepath.Dir(s.dbPath), "backups")
+}
+
+// listBackups returns the snapshot files in dir, newest first. Their time comes from the file name,
+// which survives copying the directory elsewhere.
+func listBackups(dir string) ([]Backup, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []Backup{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupExt) {
+			continue
+		}
+
+		created, err := time.ParseInLocation(backupTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupExt), time.Local)
+		if err != nil {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, Backup{Name: name, Path: filepath.Join(dir, name), Size: info.Size(), CreatedAt: created})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
@@ -0,0 +1,470 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"picturebot-backend/internal/events"
+	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/repository"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Naming schemes for the files inside an export archive.
+const (
+	ExportNamingOriginal = "original" // The name in the library, e.g. 000042.JPG
+	ExportNamingAlbum    = "album"    // Prefixed with the album name, e.g. Smith Wedding_000042.JPG
+	ExportNamingSequence = "sequence" // Album name and a number counting the exported shots, e.g. Smith Wedding_0007.JPG
+)
+
+const (
+	exportManifestFile = "manifest.json"
+	exportRetention    = 24 * time.Hour // How long finished background exports can be downloaded
+)
+
+var (
+	ErrExportNotFound = errors.New("export not found")
+	ErrExportRunning  = errors.New("export is still running")
+)
+
+// ExportService writes albums into ZIP archives for delivery, either straight to the client
+// or as a background job whose archive is downloaded afterwards.
+type ExportService struct {
+	hierarchyRepo *repository.HierarchyRepository
+	broker        *events.Broker
+	dir           string // Where background exports are written
+
+	mu      sync.Mutex
+	exports map[string]*ExportStatus
+}
+
+func NewExportService(hierarchyRepo *repository.HierarchyRepository, broker *events.Broker) *ExportService {
+	return &ExportService{
+		hierarchyRepo: hierarchyRepo,
+		broker:        broker,
+		dir:           filepath.Join(os.TempDir(), "picturebot-exports"),
+		exports:       make(map[string]*ExportStatus),
+	}
+}
+
+// ExportRequest selects what goes into an archive. Filters combine, so min_rating 3 with flag pick
+// exports the picks rated three stars or more.
+type ExportRequest struct {
+	SubFolders []string `json:"sub_folders"` // Subfolder names, empty exports every subfolder
+	PictureIDs []uint   `json:"picture_ids"` // Only these pictures, empty exports all that match the filters
+	MinRating  int      `json:"min_rating"`
+	Flag       string   `json:"flag"`   // Only pictures with this pick flag
+	Naming     string   `json:"naming"` // One of the ExportNaming schemes, empty keeps the original names
+}
+
+// ExportStatus describes a background export.
+type ExportStatus struct {
+	Job       Job       `json:"job"`
+	FileName  string    `json:"file_name"` // Suggested name of the archive
+	Size      int64     `json:"size,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	path string
+}
+
+// ExportManifest is written into every archive as manifest.json.
+type ExportManifest struct {
+	Album      string         `json:"album"`
+	AlbumUUID  string         `json:"album_uuid"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Request    ExportRequest  `json:"request"`
+	Files      []ExportedFile `json:"files"`
+	Skipped    []ExportedFile `json:"skipped,omitempty"` // Files that could not be read
+}
+
+// ExportedFile links a file in the archive to the picture it came from.
+type ExportedFile struct {
+	Name       string     `json:"name"` // Path inside the archive
+	Original   string     `json:"original"`
+	SubFolder  string     `json:"sub_folder"`
+	Index      string     `json:"index"`
+	Rating     int        `json:"rating"`
+	Flag       string     `json:"flag,omitempty"`
+	CapturedAt *time.Time `json:"captured_at,omitempty"`
+	Size       int64      `json:"size"`
+	Hash       string     `json:"hash,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// ExportPlan is a validated export, ready to be written.
+type ExportPlan struct {
+	FileName string
+	album    *model.Hierarchy
+	request  ExportRequest
+	entries  []exportEntry
+}
+
+type exportEntry struct {
+	picture   model.Picture
+	subFolder string
+	name      string
+}
+
+// Plan validates an export request and decides which files go into the archive under which names.
+func (s *ExportService) Plan(albumID uint, req ExportRequest) (*ExportPlan, error) {
+	album, err := s.hierarchyRepo.FindByIDWithPictures(albumID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNodeNotFound
+		}
+		slog.Error("Service error: failed to load album for export", "id", albumID, "error", err)
+		return nil, err
+	}
+	if album.Type != model.TypeAlbum {
+		return nil, fmt.Errorf("%w: node %d is not an album", ErrInvalidUpdate, albumID)
+	}
+
+	verr := &ValidationError{}
+
+	req.Naming = strings.TrimSpace(req.Naming)
+	switch req.Naming {
+	case "":
+		req.Naming = ExportNamingOriginal
+	case ExportNamingOriginal, ExportNamingAlbum, ExportNamingSequence:
+	default:
+		verr.add("naming", CodeInvalid, fmt.Sprintf("naming must be %q, %q or %q", ExportNamingOriginal, ExportNamingAlbum, ExportNamingSequence))
+	}
+
+	switch req.Flag {
+	case "", model.FlagPick, model.FlagReject:
+	default:
+		verr.add("flag", CodeInvalid, fmt.Sprintf("flag must be %q or %q", model.FlagPick, model.FlagReject))
+	}
+
+	if req.MinRating < 0 || req.MinRating > 5 {
+		verr.add("min_rating", CodeInvalid, "minimum rating must be between 0 and 5")
+	}
+
+	subFolders := make(map[string]bool)
+	for _, name := range req.SubFolders {
+		found := false
+		for _, sf := range album.SubFolders {
+			if strings.EqualFold(sf.Name, name) {
+				subFolders[sf.Name] = true
+				found = true
+			}
+		}
+		if !found {
+			verr.add("sub_folders", CodeNotFound, fmt.Sprintf("album has no subfolder %q", name))
+		}
+	}
+
+	inAlbum := make(map[uint]bool)
+	for _, sf := range album.SubFolders {
+		for _, p := range sf.Pictures {
+			inAlbum[p.ID] = true
+		}
+	}
+	pictureIDs := make(map[uint]bool)
+	for _, id := range req.PictureIDs {
+		if !inAlbum[id] {
+			verr.add("picture_ids", CodeNotFound, fmt.Sprintf("picture %d is not in this album", id))
+		}
+		pictureIDs[id] = true
+	}
+
+	if err := verr.orNil(); err != nil {
+		return nil, err
+	}
+
+	var entries []exportEntry
+	for _, sf := range album.SubFolders {
+		if len(subFolders) > 0 && !subFolders[sf.Name] {
+			continue
+		}
+		for _, p := range sf.Pictures {
+			if len(pictureIDs) > 0 && !pictureIDs[p.ID] {
+				continue
+			}
+			if p.Rating < req.MinRating || (req.Flag != "" && p.Flag != req.Flag) || p.MissingAt != nil {
+				continue
+			}
+			entries = append(entries, exportEntry{picture: p, subFolder: sf.Name})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.picture.Index != b.picture.Index {
+			return a.picture.Index < b.picture.Index
+		}
+		if a.subFolder != b.subFolder {
+			return a.subFolder < b.subFolder
+		}
+		// The original of a shot comes before its edits, so it keeps the unsuffixed name
+		if aOrig, bOrig := isShotOriginal(a.picture), isShotOriginal(b.picture); aOrig != bOrig {
+			return aOrig
+		}
+		return a.picture.FileName < b.picture.FileName
+	})
+
+	nameEntries(entries, album.Name, req.Naming)
+
+	return &ExportPlan{
+		FileName: album.Name + ".zip",
+		album:    album,
+		request:  req,
+		entries:  entries,
+	}, nil
+}
+
+// isShotOriginal reports whether the file is named after its index alone, e.g. 000012.JPG but not 000012-edit.JPG.
+func isShotOriginal(p model.Picture) bool {
+	return strings.TrimSuffix(p.FileName, p.Extension) == p.Index
+}
+
+// nameEntries sets the path of every entry inside the archive. Subfolders become directories
+// when more than one is exported, so equal names from different subfolders cannot collide.
+// Files of one shot that would still share a name, e.g. an edit numbered like its original,
+// get a -2, -3, ... suffix.
+func nameEntries(entries []exportEntry, albumName, naming string) {
+	folders := make(map[string]bool)
+	shots := make(map[string]int) // Sequence number per picture index
+	for _, e := range entries {
+		folders[e.subFolder] = true
+		if _, ok := shots[e.picture.Index]; !ok {
+			shots[e.picture.Index] = len(shots) + 1
+		}
+	}
+	width := max(4, len(fmt.Sprint(len(shots))))
+
+	used := map[string]bool{exportManifestFile: true}
+	for i := range entries {
+		e := &entries[i]
+		name := e.picture.FileName
+		switch naming {
+		case ExportNamingAlbum:
+			name = albumName + "_" + name
+		case ExportNamingSequence:
+			name = fmt.Sprintf("%s_%0*d%s", albumName, width, shots[e.picture.Index], e.picture.Extension)
+		}
+		if len(folders) > 1 {
+			name = e.subFolder + "/" + name
+		}
+
+		ext := path.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s-%d%s", base, n, ext)
+		}
+		used[strings.ToLower(name)] = true
+		e.name = name
+	}
+}
+
+// Write streams the archive of a plan to w. Files that cannot be read are left out and listed in the
+// manifest, so a long download is not lost over one bad file. ctx ends the export early.
+func (s *ExportService) Write(ctx context.Context, plan *ExportPlan, w io.Writer) error {
+	job := startJob(s.broker, JobExport, len(plan.entries), plan.album.ID)
+	err := s.write(ctx, plan, w, job)
+	job.finish(err)
+	return err
+}
+
+func (s *ExportService) write(ctx context.Context, plan *ExportPlan, w io.Writer, job *Job) error {
+	zw := zip.NewWriter(w)
+
+	manifest := ExportManifest{
+		Album:      plan.album.Name,
+		AlbumUUID:  plan.album.UUID,
+		ExportedAt: time.Now(),
+		Request:    plan.request,
+		Files:      []ExportedFile{},
+	}
+
+	for _, e := range plan.entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		file := ExportedFile{
+			Name:       e.name,
+			Original:   e.picture.FileName,
+			SubFolder:  e.subFolder,
+			Index:      e.picture.Index,
+			Rating:     e.picture.Rating,
+			Flag:       e.picture.Flag,
+			CapturedAt: e.picture.CapturedAt,
+			Size:       e.picture.Size,
+			Hash:       e.picture.Hash,
+		}
+
+		if err := addExportFile(zw, e); err != nil {
+			var pathErr *os.PathError
+			if !errors.As(err, &pathErr) {
+				return err // The archive itself could not be written
+			}
+			slog.Warn("IO warning: export skipped unreadable file", "path", e.picture.Location, "error", err)
+			file.Error = err.Error()
+			manifest.Skipped = append(manifest.Skipped, file)
+		} else {
+			manifest.Files = append(manifest.Files, file)
+		}
+		job.step(1)
+	}
+
+	mw, err := zw.Create(exportManifestFile)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	slog.Info("Album exported", "album", plan.album.Name, "files", len(manifest.Files), "skipped", len(manifest.Skipped))
+	return nil
+}
+
+// addExportFile copies one picture into the archive. Pictures are already compressed, so they are stored as is.
+func addExportFile(zw *zip.Writer, e exportEntry) error {
+	f, err := os.Open(e.picture.Location)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := &zip.FileHeader{Name: e.name, Method: zip.Store}
+	if info, err := f.Stat(); err == nil {
+		header.Modified = info.ModTime()
+	}
+
+	fw, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, f)
+	return err
+}
+
+// Start writes the archive of a plan in the background and returns its status right away.
+// Progress is published as job.progress events; the archive is kept for exportRetention.
+func (s *ExportService) Start(plan *ExportPlan) (*ExportStatus, error) {
+	s.removeExpired()
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		slog.Error("IO error: failed to create export directory", "path", s.dir, "error", err)
+		return nil, err
+	}
+
+	job := startJob(s.broker, JobExport, len(plan.entries), plan.album.ID)
+	status := &ExportStatus{
+		Job:       *job,
+		FileName:  plan.FileName,
+		CreatedAt: time.Now(),
+		path:      filepath.Join(s.dir, job.ID+".zip"),
+	}
+
+	s.mu.Lock()
+	s.exports[job.ID] = status
+	s.mu.Unlock()
+
+	job.observe = func(progress Job) {
+		s.mu.Lock()
+		status.Job = progress
+		s.mu.Unlock()
+	}
+
+	go func() {
+		err := s.writeFile(plan, status.path, job)
+		if err != nil {
+			slog.Error("Service error: background export failed", "album", plan.album.Name, "error", err)
+		} else if info, statErr := os.Stat(status.path); statErr == nil {
+			s.mu.Lock()
+			status.Size = info.Size()
+			s.mu.Unlock()
+		}
+		job.finish(err)
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := *status
+	return &result, nil
+}
+
+// writeFile writes the archive under a temporary name, so only complete archives can be downloaded.
+func (s *ExportService) writeFile(plan *ExportPlan, path string, job *Job) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	err = s.write(context.Background(), plan, f, job)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Status returns a background export.
+func (s *ExportService) Status(id string) (*ExportStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.exports[id]
+	if !ok {
+		return nil, ErrExportNotFound
+	}
+	result := *status
+	return &result, nil
+}
+
+// Archive returns the file of a finished background export.
+func (s *ExportService) Archive(id string) (path string, name string, err error) {
+	status, err := s.Status(id)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch status.Job.State {
+	case JobRunning:
+		return "", "", ErrExportRunning
+	case JobFailed:
+		return "", "", fmt.Errorf("%w: the export failed: %s", ErrExportNotFound, status.Job.Error)
+	}
+	return status.path, status.FileName, nil
+}
+
+// removeExpired deletes finished exports older than exportRetention.
+func (s *ExportService) removeExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, status := range s.exports {
+		if status.Job.State == JobRunning || time.Since(status.CreatedAt) < exportRetention {
+			continue
+		}
+		if err := os.Remove(status.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("IO warning: failed to remove expired export", "path", status.path, "error", err)
+		}
+		delete(s.exports, id)
+	}
+}
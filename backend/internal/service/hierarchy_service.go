@@ -1,19 +1,24 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"picturebot-backend/internal/events"
 	"picturebot-backend/internal/model"
 	"picturebot-backend/internal/repository"
+	"picturebot-backend/internal/search"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type pictureGroup struct {
@@ -26,17 +31,36 @@ type fileEntry struct {
 	Extension string
 	FullPath  string
 	ModTime   time.Time
+	Size      int64
 }
 
+// libraryRoot is the directory that holds every album's UUID directory.
+const libraryRoot = "M:\\Picturebot-Test"
+
+// trashDir is where deleted album directories are moved to, relative to libraryRoot.
+const trashDir = ".trash"
+
+var (
+	ErrNodeNotFound  = errors.New("node not found")
+	ErrDuplicateName = errors.New("a node with this name already exists here")
+	ErrInvalidUpdate = errors.New("invalid update")
+)
+
 type HierarchyService struct {
-	repo        *repository.HierarchyRepository
-	pictureRepo *repository.PictureRepository
+	repo          *repository.HierarchyRepository
+	pictureRepo   *repository.PictureRepository
+	subFolderRepo *repository.SubFolderRepository
+	settingsRepo  *repository.SettingsRepository
+	broker        *events.Broker
 }
 
-func NewHierarchyService(repo *repository.HierarchyRepository, pictureRepo *repository.PictureRepository) *HierarchyService {
+func NewHierarchyService(repo *repository.HierarchyRepository, pictureRepo *repository.PictureRepository, subFolderRepo *repository.SubFolderRepository, settingsRepo *repository.SettingsRepository, broker *events.Broker) *HierarchyService {
 	return &HierarchyService{
-		repo:        repo,
-		pictureRepo: pictureRepo,
+		repo:          repo,
+		pictureRepo:   pictureRepo,
+		subFolderRepo: subFolderRepo,
+		settingsRepo:  settingsRepo,
+		broker:        broker,
 	}
 }
 
@@ -44,8 +68,10 @@ type CreateNodeRequest struct {
 	ParentID   uint                `json:"parent_id"`
 	Name       string              `json:"name"`
 	Type       model.HierarchyType `json:"type"`
-	SubFolders []model.SubFolder   `json:"sub_folders"`
+	SubFolders []model.SubFolder   `json:"sub_folders"` // Extra subfolders on top of the template, only the names are used
 	SourcePath string              `json:"source_path"`
+	Query      string              `json:"query"`
+	Template   string              `json:"template"` // Subfolder template from the settings, empty uses the default
 }
 
 // CreateNode handles the business logic for creating folders and albums, including disk operations.
@@ -55,26 +81,36 @@ func (s *HierarchyService) CreateNode(req CreateNodeRequest) (*model.Hierarchy,
 		parentID = &req.ParentID
 	}
 
-	// Prevent Duplicate Folders
-	if req.Type == model.TypeFolder {
-		exists, err := s.repo.FindDuplicate(parentID, req.Name, req.Type)
+	req.Name = strings.TrimSpace(req.Name)
+
+	if err := s.validateCreateNode(req); err != nil {
+		slog.Info("Service: Rejected node creation", "name", req.Name, "type", req.Type, "error", err)
+		return nil, err
+	}
+
+	var subFolderNames []string
+	if req.Type == model.TypeAlbum {
+		settings, err := s.settingsRepo.GetSettings()
 		if err != nil {
-			slog.Error("Service error: failed to check for duplicate folders", "name", req.Name, "error", err)
+			slog.Error("Service error: failed to load settings", "error", err)
 			return nil, err
 		}
+		subFolderNames, _ = resolveSubFolders(settings, req)
+	}
 
-		if exists {
-			slog.Info("Service: Attempted to create duplicate folder", "name", req.Name)
-			return nil, errors.New("a folder with this name already exists here")
-		}
+	position, err := s.repo.NextPosition(parentID)
+	if err != nil {
+		slog.Error("Service error: failed to determine node position", "name", req.Name, "error", err)
+		return nil, err
 	}
 
 	newNode := &model.Hierarchy{
-		ParentID:   parentID,
-		Name:       req.Name,
-		Type:       req.Type,
-		Children:   []*model.Hierarchy{},
-		SubFolders: req.SubFolders,
+		ParentID: parentID,
+		Name:     req.Name,
+		Type:     req.Type,
+		Query:    req.Query,
+		Position: position,
+		Children: []*model.Hierarchy{},
 	}
 
 	// Album Logic: UUID generation and directory creation
@@ -86,31 +122,26 @@ func (s *HierarchyService) CreateNode(req CreateNodeRequest) (*model.Hierarchy,
 		}
 
 		newNode.UUID = id.String()
+		albumRoot := filepath.Join(libraryRoot, newNode.UUID)
 
-		if req.SourcePath != "" {
-			libraryRoot := "M:\\Picturebot-Test" // Root path for library
-			albumRoot := filepath.Join(libraryRoot, newNode.UUID)
-
-			// Prepare standard subfolders
-			standardFolders := []string{"RAWs", "JPGs"}
-			for _, fName := range standardFolders {
-				newNode.SubFolders = append(newNode.SubFolders, model.SubFolder{
-					Name:     fName,
-					Location: filepath.Join(albumRoot, fName),
-				})
-			}
+		// Prepare the subfolders of the chosen template
+		for _, fName := range subFolderNames {
+			newNode.SubFolders = append(newNode.SubFolders, model.SubFolder{
+				Name:     fName,
+				Location: filepath.Join(albumRoot, fName),
+			})
+		}
 
-			// Create directories on disk
-			if err := os.MkdirAll(albumRoot, 0755); err != nil {
-				slog.Error("IO error: failed to create album directory", "path", albumRoot, "error", err)
-				return nil, fmt.Errorf("failed to create album directory: %w", err)
-			}
+		// Create directories on disk
+		if err := os.MkdirAll(albumRoot, 0755); err != nil {
+			slog.Error("IO error: failed to create album directory", "path", albumRoot, "error", err)
+			return nil, fmt.Errorf("failed to create album directory: %w", err)
+		}
 
-			for _, sub := range newNode.SubFolders {
-				if err := os.MkdirAll(sub.Location, 0755); err != nil {
-					slog.Error("IO error: failed to create subfolder", "path", sub.Location, "error", err)
-					return nil, fmt.Errorf("failed to create subfolder %s: %w", sub.Name, err)
-				}
+		for _, sub := range newNode.SubFolders {
+			if err := os.MkdirAll(sub.Location, 0755); err != nil {
+				slog.Error("IO error: failed to create subfolder", "path", sub.Location, "error", err)
+				return nil, fmt.Errorf("failed to create subfolder %s: %w", sub.Name, err)
 			}
 		}
 	}
@@ -119,19 +150,340 @@ func (s *HierarchyService) CreateNode(req CreateNodeRequest) (*model.Hierarchy,
 		return nil, err
 	}
 
+	s.broker.Publish(events.NodeCreated, newNode)
+
 	// Trigger Import process if a SourcePath is provided
 	if req.Type == model.TypeAlbum && req.SourcePath != "" {
 		slog.Info("Starting import", "source", req.SourcePath, "album", newNode.Name)
-		if err := s.processAndImportPictures(req.SourcePath, newNode); err != nil {
+		if _, err := s.processAndImportPictures(req.SourcePath, newNode); err != nil {
 			slog.Error("Import failed", "album", newNode.Name, "error", err)
 			return newNode, fmt.Errorf("album created but import failed: %w", err)
 		}
 		slog.Info("Import completed successfully", "album", newNode.Name)
 	}
 
+	if req.Type == model.TypeAlbum {
+		s.writeManifests(newNode.ID)
+	}
+
 	return newNode, nil
 }
 
+type UpdateNodeRequest struct {
+	Name     *string         `json:"name"`
+	ParentID *uint           `json:"parent_id"`        // 0 moves the node to the root
+	SortMode *model.SortMode `json:"sort_mode"`        // How a folder orders its children
+	CoverID  *uint           `json:"cover_picture_id"` // 0 falls back to the default cover
+
+	// Album details; an empty string clears a field
+	Description *string            `json:"description"`
+	EventStart  *string            `json:"event_start"` // 2025-06-14 or RFC 3339
+	EventEnd    *string            `json:"event_end"`
+	Location    *string            `json:"location"`
+	Client      *string            `json:"client"`
+	Contact     *string            `json:"contact"`
+	Attributes  map[string]*string `json:"attributes"` // A null value removes the key
+}
+
+// UpdateNode renames a node and/or moves it under a new parent folder.
+func (s *HierarchyService) UpdateNode(id uint, req UpdateNodeRequest) (*model.Hierarchy, error) {
+	node, err := s.repo.FindByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNodeNotFound
+		}
+		slog.Error("Service error: failed to load node", "id", id, "error", err)
+		return nil, err
+	}
+
+	verr := &ValidationError{}
+
+	if req.Name != nil {
+		node.Name = strings.TrimSpace(*req.Name)
+		verr.addField(validateNodeName(node.Name))
+	}
+
+	if req.SortMode != nil {
+		if node.Type != model.TypeFolder {
+			verr.add("sort_mode", CodeNotAllowed, "only folders have a sort mode")
+		} else {
+			verr.addField(validateSortMode("sort_mode", *req.SortMode))
+			node.SortMode = *req.SortMode
+		}
+	}
+
+	if req.CoverID != nil {
+		fe, err := s.validateCover(node, *req.CoverID)
+		if err != nil {
+			slog.Error("Service error: failed to check cover picture", "id", node.ID, "error", err)
+			return nil, err
+		}
+		verr.addField(fe)
+
+		if *req.CoverID == 0 {
+			node.CoverPictureID = nil
+		} else {
+			coverID := *req.CoverID
+			node.CoverPictureID = &coverID
+		}
+	}
+
+	setAttrs, removeAttrs := applyAlbumDetails(node, req, verr)
+
+	oldParent := node.ParentID
+
+	if req.ParentID != nil {
+		if *req.ParentID == 0 {
+			node.ParentID = nil
+		} else {
+			fe, err := s.validateParent(node.ID, *req.ParentID)
+			if err != nil {
+				slog.Error("Service error: failed to check new parent", "id", node.ID, "error", err)
+				return nil, err
+			}
+			verr.addField(fe)
+
+			parentID := *req.ParentID
+			node.ParentID = &parentID
+		}
+	}
+
+	if len(verr.Fields) == 0 {
+		fe, err := s.validateUnique(node.ParentID, node.Name, node.Type, node.ID)
+		if err != nil {
+			slog.Error("Service error: failed to check for duplicate nodes", "name", node.Name, "error", err)
+			return nil, err
+		}
+		verr.addField(fe)
+	}
+
+	if err := verr.orNil(); err != nil {
+		slog.Info("Service: Rejected node update", "id", node.ID, "error", err)
+		return nil, err
+	}
+
+	// A moved node goes to the end of its new siblings
+	if !sameParent(oldParent, node.ParentID) {
+		position, err := s.repo.NextPosition(node.ParentID)
+		if err != nil {
+			slog.Error("Service error: failed to determine node position", "id", node.ID, "error", err)
+			return nil, err
+		}
+		node.Position = position
+	}
+
+	if err := s.repo.UpdateWithAttributes(node, setAttrs, removeAttrs); err != nil {
+		slog.Error("Service error: failed to update node", "id", node.ID, "error", err)
+		return nil, err
+	}
+
+	slog.Info("Node updated", "id", node.ID, "name", node.Name)
+	s.writeManifests(node.ID)
+
+	node.Attributes, err = s.repo.FindAttributes(node.ID)
+	if err != nil {
+		slog.Error("Service error: failed to load node attributes", "id", node.ID, "error", err)
+		return nil, err
+	}
+
+	node.Children = []*model.Hierarchy{}
+	s.broker.Publish(events.NodeUpdated, node)
+	return node, nil
+}
+
+func sameParent(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// ReorderChildren stores a manual order for the children of a folder, or of the root when parentID is 0,
+// and switches that level to manual sorting. childIDs must list every child exactly once.
+func (s *HierarchyService) ReorderChildren(parentID uint, childIDs []uint) ([]*model.Hierarchy, error) {
+	var parent *model.Hierarchy
+	var parentRef *uint
+
+	if parentID != 0 {
+		node, err := s.repo.FindByID(parentID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrNodeNotFound
+			}
+			slog.Error("Service error: failed to load node", "id", parentID, "error", err)
+			return nil, err
+		}
+
+		if node.Type != model.TypeFolder {
+			return nil, &ValidationError{Fields: []FieldError{{Field: "id", Code: CodeNotFolder, Message: "only folders have children to reorder"}}}
+		}
+
+		parent = node
+		parentRef = &node.ID
+	}
+
+	children, err := s.repo.FindChildren(parentRef)
+	if err != nil {
+		slog.Error("Service error: failed to load children", "id", parentID, "error", err)
+		return nil, err
+	}
+
+	current := make(map[uint]bool, len(children))
+	for _, child := range children {
+		current[child.ID] = true
+	}
+
+	seen := make(map[uint]bool, len(childIDs))
+	for _, id := range childIDs {
+		if !current[id] || seen[id] {
+			return nil, &ValidationError{Fields: []FieldError{{Field: "child_ids", Code: CodeInvalid, Message: fmt.Sprintf("node %d is not a child here or is listed twice", id)}}}
+		}
+		seen[id] = true
+	}
+
+	if len(seen) != len(current) {
+		return nil, &ValidationError{Fields: []FieldError{{Field: "child_ids", Code: CodeInvalid, Message: "every child must be listed exactly once"}}}
+	}
+
+	if err := s.repo.UpdatePositions(childIDs); err != nil {
+		slog.Error("Service error: failed to store child order", "id", parentID, "error", err)
+		return nil, err
+	}
+
+	if parent != nil {
+		parent.SortMode = model.SortManual
+		if err := s.repo.Update(parent); err != nil {
+			slog.Error("Service error: failed to switch folder to manual sorting", "id", parentID, "error", err)
+			return nil, err
+		}
+	} else {
+		if err := s.settingsRepo.SetRootSortMode(model.SortManual); err != nil {
+			slog.Error("Service error: failed to switch root to manual sorting", "error", err)
+			return nil, err
+		}
+	}
+
+	slog.Info("Children reordered", "parent", parentID, "count", len(childIDs))
+
+	reordered, err := s.repo.FindChildren(parentRef)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, child := range reordered {
+		child.Children = []*model.Hierarchy{}
+		s.broker.Publish(events.NodeUpdated, child)
+	}
+
+	return reordered, nil
+}
+
+// DeleteNodeResult describes what a delete removed, or would remove in preview mode.
+type DeleteNodeResult struct {
+	Preview bool `json:"preview"`
+	repository.SubtreeCounts
+	TrashedDirectories []string `json:"trashed_directories,omitempty"`
+	KeptDirectories    []string `json:"kept_directories,omitempty"` // Album directories left in the library without trash
+}
+
+// DeleteNode removes a node and everything below it. With preview set nothing is changed and only the counts are returned.
+// With trash set the album directories are moved into the library trash after the rows are gone. Without it they stay
+// where they are and are listed in the result; the library check reports them as orphan directories.
+func (s *HierarchyService) DeleteNode(id uint, preview bool, trash bool) (*DeleteNodeResult, error) {
+	nodes, err := s.repo.FindSubtree(id)
+	if err != nil {
+		slog.Error("Service error: failed to load subtree", "id", id, "error", err)
+		return nil, err
+	}
+
+	if len(nodes) == 0 {
+		return nil, ErrNodeNotFound
+	}
+
+	counts, err := s.repo.CountSubtree(nodes)
+	if err != nil {
+		slog.Error("Service error: failed to count subtree", "id", id, "error", err)
+		return nil, err
+	}
+
+	result := &DeleteNodeResult{Preview: preview, SubtreeCounts: counts}
+	if preview {
+		return result, nil
+	}
+
+	ids := make([]uint, 0, len(nodes))
+	for _, n := range nodes {
+		ids = append(ids, n.ID)
+	}
+
+	if err := s.repo.DeleteSubtree(ids); err != nil {
+		slog.Error("Service error: failed to delete subtree", "id", id, "error", err)
+		return nil, err
+	}
+
+	slog.Info("Nodes deleted", "id", id, "nodes", len(ids), "pictures", counts.Pictures)
+	s.broker.Publish(events.NodeDeleted, DeletedNodes{ID: id, IDs: ids})
+
+	if !trash {
+		// The files stay, but a rebuild must not bring the deleted albums back
+		for _, n := range nodes {
+			if n.Type != model.TypeAlbum || n.UUID == "" {
+				continue
+			}
+			albumRoot := filepath.Join(libraryRoot, n.UUID)
+			if _, err := os.Stat(albumRoot); errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			manifest := filepath.Join(albumRoot, manifestFile)
+			if err := os.Remove(manifest); err != nil && !errors.Is(err, os.ErrNotExist) {
+				slog.Warn("IO warning: failed to remove album manifest", "path", manifest, "error", err)
+			}
+			result.KeptDirectories = append(result.KeptDirectories, albumRoot)
+		}
+		if len(result.KeptDirectories) > 0 {
+			slog.Info("Album directories kept after delete", "id", id, "directories", result.KeptDirectories)
+		}
+		return result, nil
+	}
+
+	for _, n := range nodes {
+		if n.Type != model.TypeAlbum || n.UUID == "" {
+			continue
+		}
+
+		albumRoot := filepath.Join(libraryRoot, n.UUID)
+		if _, err := os.Stat(albumRoot); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		dest, err := moveToTrash(albumRoot)
+		if err != nil {
+			slog.Error("IO error: failed to move album to trash", "path", albumRoot, "error", err)
+			return result, fmt.Errorf("nodes deleted but moving %s to trash failed: %w", albumRoot, err)
+		}
+
+		result.TrashedDirectories = append(result.TrashedDirectories, dest)
+		slog.Debug("Album directory moved to trash", "album", n.Name, "path", dest)
+	}
+
+	return result, nil
+}
+
+// moveToTrash moves a directory from the library into the trash and returns its new location.
+func moveToTrash(path string) (string, error) {
+	trashRoot := filepath.Join(libraryRoot, trashDir)
+	if err := os.MkdirAll(trashRoot, 0755); err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(trashRoot, filepath.Base(path))
+	if _, err := os.Stat(dest); err == nil {
+		dest = fmt.Sprintf("%s-%s", dest, time.Now().Format("20060102150405"))
+	}
+
+	return dest, os.Rename(path, dest)
+}
+
 // GetFullHierarchy transforms flat database rows into a nested tree structure.
 func (s *HierarchyService) GetFullHierarchy() ([]*model.Hierarchy, error) {
 	allNodes, err := s.repo.FindAll()
@@ -140,6 +492,47 @@ func (s *HierarchyService) GetFullHierarchy() ([]*model.Hierarchy, error) {
 		return nil, err
 	}
 
+	rootNodes := buildTree(allNodes)
+
+	if err := s.sortTree(rootNodes); err != nil {
+		slog.Error("Service: Failed to sort hierarchy", "error", err)
+		return nil, err
+	}
+
+	if err := s.applyCovers(allNodes); err != nil {
+		slog.Error("Service: Failed to resolve album covers", "error", err)
+		return nil, err
+	}
+
+	return rootNodes, nil
+}
+
+// applyCovers replaces the stored cover of every album with its effective cover. Passing album ids
+// limits the lookup to those albums, e.g. the ones in nodes.
+func (s *HierarchyService) applyCovers(nodes []*model.Hierarchy, albumIDs ...uint) error {
+	covers, err := s.repo.ResolveCovers(albumIDs...)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		if node.Type != model.TypeAlbum {
+			continue
+		}
+
+		if coverID, ok := covers[node.ID]; ok {
+			node.CoverPictureID = &coverID
+		} else {
+			node.CoverPictureID = nil
+		}
+	}
+
+	return nil
+}
+
+// buildTree links flat nodes to their parents and returns the root nodes.
+// Nodes whose parent is missing are treated as roots.
+func buildTree(allNodes []*model.Hierarchy) []*model.Hierarchy {
 	nodeMap := make(map[uint]*model.Hierarchy)
 	for _, node := range allNodes {
 		node.Children = []*model.Hierarchy{}
@@ -159,17 +552,319 @@ func (s *HierarchyService) GetFullHierarchy() ([]*model.Hierarchy, error) {
 		}
 	}
 
-	return rootNodes, nil
+	return rootNodes
+}
+
+// GetTree returns the whole hierarchy as summaries with picture counts instead of embedded pictures.
+func (s *HierarchyService) GetTree() ([]*model.HierarchySummary, error) {
+	rootNodes, counts, err := s.loadSummaryTree()
+	if err != nil {
+		return nil, err
+	}
+
+	return summarizeNodes(rootNodes, counts, -1), nil
+}
+
+// GetChildren returns one level of the hierarchy below a node, or the root level when id is 0.
+// Only that level and the branches below it are read, so expanding a folder stays cheap.
+func (s *HierarchyService) GetChildren(id uint) ([]*model.HierarchySummary, error) {
+	var parentRef *uint
+	var mode model.SortMode
+
+	if id == 0 {
+		settings, err := s.settingsRepo.GetSettings()
+		if err != nil {
+			return nil, err
+		}
+		mode = settings.RootSortMode
+	} else {
+		parent, err := s.repo.FindByID(id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrNodeNotFound
+			}
+			return nil, err
+		}
+		parentRef = &id
+		mode = parent.SortMode
+	}
+
+	children, err := s.repo.FindChildren(parentRef)
+	if err != nil {
+		slog.Error("Service: Failed to retrieve children", "id", id, "error", err)
+		return nil, err
+	}
+
+	totals, err := s.repo.FindBranchTotals(parentRef)
+	if err != nil {
+		slog.Error("Service: Failed to count pictures", "id", id, "error", err)
+		return nil, err
+	}
+
+	counts := make(map[uint]int64, len(children))
+	firstTimes := make(map[uint]time.Time, len(children))
+	var albumIDs []uint
+	for _, child := range children {
+		if t, ok := totals[child.ID]; ok && child.Type != model.TypeSmart {
+			counts[child.ID] = t.Pictures
+			if t.FirstCapture != nil {
+				firstTimes[child.ID] = *t.FirstCapture
+			}
+		}
+		if child.Type == model.TypeAlbum {
+			albumIDs = append(albumIDs, child.ID)
+		}
+	}
+
+	sortNodes(children, mode, firstTimes)
+
+	if len(albumIDs) > 0 {
+		if err := s.applyCovers(children, albumIDs...); err != nil {
+			slog.Error("Service: Failed to resolve album covers", "error", err)
+			return nil, err
+		}
+	}
+
+	if err := s.countSmartAlbums(children, counts); err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*model.HierarchySummary, 0, len(children))
+	for _, child := range children {
+		sum := summarize(child)
+		sum.ChildCount = totals[child.ID].Children
+		sum.PictureCount = counts[child.ID]
+		summaries = append(summaries, sum)
+	}
+
+	return summaries, nil
+}
+
+// SearchAlbums returns the albums matching a query in the search language, without their pictures.
+func (s *HierarchyService) SearchAlbums(raw string) ([]*model.Hierarchy, error) {
+	node, err := search.Parse(raw)
+	if err != nil {
+		slog.Info("Service: Rejected album search query", "query", raw, "error", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+
+	albums, err := s.repo.SearchAlbums(node)
+	if err != nil {
+		slog.Error("Service error: Failed to search albums", "query", raw, "error", err)
+		return nil, err
+	}
+
+	for _, album := range albums {
+		album.Children = []*model.Hierarchy{}
+	}
+
+	return albums, nil
+}
+
+// GetAncestors returns the breadcrumb trail from the root down to and including a node.
+func (s *HierarchyService) GetAncestors(id uint) ([]*model.HierarchySummary, error) {
+	nodes, err := s.repo.FindAncestors(id)
+	if err != nil {
+		slog.Error("Service error: failed to load ancestors", "id", id, "error", err)
+		return nil, err
+	}
+
+	if len(nodes) == 0 {
+		return nil, ErrNodeNotFound
+	}
+
+	trail := make([]*model.HierarchySummary, 0, len(nodes))
+	for _, n := range nodes {
+		trail = append(trail, summarize(n))
+	}
+
+	return trail, nil
 }
 
-// processAndImportPictures handles file grouping, sorting, renaming, and copying.
-func (s *HierarchyService) processAndImportPictures(sourceDir string, hierarchy *model.Hierarchy) error {
+// loadSummaryTree builds the sorted tree without pictures and counts the pictures of every node.
+func (s *HierarchyService) loadSummaryTree() ([]*model.Hierarchy, map[uint]int64, error) {
+	allNodes, err := s.repo.FindAllNodes()
+	if err != nil {
+		slog.Error("Service: Failed to retrieve hierarchy nodes", "error", err)
+		return nil, nil, err
+	}
+
+	rootNodes := buildTree(allNodes)
+	if err := s.sortTree(rootNodes); err != nil {
+		slog.Error("Service: Failed to sort hierarchy", "error", err)
+		return nil, nil, err
+	}
+
+	if err := s.applyCovers(allNodes); err != nil {
+		slog.Error("Service: Failed to resolve album covers", "error", err)
+		return nil, nil, err
+	}
+
+	counts, err := s.repo.CountPicturesByNode()
+	if err != nil {
+		slog.Error("Service: Failed to count pictures", "error", err)
+		return nil, nil, err
+	}
+
+	if err := s.countSmartAlbums(allNodes, counts); err != nil {
+		return nil, nil, err
+	}
+
+	// Folders report the pictures of every album below them
+	var rollUp func(node *model.Hierarchy) int64
+	rollUp = func(node *model.Hierarchy) int64 {
+		if node.Type == model.TypeSmart {
+			return 0
+		}
+		total := counts[node.ID]
+		for _, child := range node.Children {
+			total += rollUp(child)
+		}
+		if node.Type == model.TypeFolder {
+			counts[node.ID] = total
+		}
+		return total
+	}
+	for _, node := range rootNodes {
+		rollUp(node)
+	}
+
+	return rootNodes, counts, nil
+}
+
+// countSmartAlbums counts the pictures of every smart album among nodes by running its query.
+// Albums with an invalid query are left out.
+func (s *HierarchyService) countSmartAlbums(nodes []*model.Hierarchy, counts map[uint]int64) error {
+	for _, node := range nodes {
+		if node.Type != model.TypeSmart {
+			continue
+		}
+
+		parsed, err := search.Parse(node.Query)
+		if err != nil {
+			slog.Warn("Service: Smart album has an invalid query", "id", node.ID, "error", err)
+			continue
+		}
+
+		_, total, err := s.pictureRepo.Search(parsed, repository.PictureQuery{Limit: 1, Fields: []string{"id"}})
+		if err != nil {
+			return err
+		}
+		counts[node.ID] = total
+	}
+
+	return nil
+}
+
+// summarizeNodes converts nodes to summaries, descending depth levels into their children (-1 for all).
+func summarizeNodes(nodes []*model.Hierarchy, counts map[uint]int64, depth int) []*model.HierarchySummary {
+	summaries := make([]*model.HierarchySummary, 0, len(nodes))
+	for _, n := range nodes {
+		sum := summarize(n)
+		sum.ChildCount = len(n.Children)
+		sum.PictureCount = counts[n.ID]
+		if depth != 0 && len(n.Children) > 0 {
+			sum.Children = summarizeNodes(n.Children, counts, depth-1)
+		}
+		summaries = append(summaries, sum)
+	}
+	return summaries
+}
+
+func summarize(n *model.Hierarchy) *model.HierarchySummary {
+	return &model.HierarchySummary{
+		ID:           n.ID,
+		ParentID:     n.ParentID,
+		Type:         n.Type,
+		Name:         n.Name,
+		UUID:         n.UUID,
+		Query:        n.Query,
+		Position:     n.Position,
+		SortMode:     n.SortMode,
+		CoverPicture: n.CoverPictureID,
+	}
+}
+
+// sortTree orders the root nodes by the root sort mode setting and every folder's children by its own sort mode.
+func (s *HierarchyService) sortTree(rootNodes []*model.Hierarchy) error {
+	settings, err := s.settingsRepo.GetSettings()
+	if err != nil {
+		return err
+	}
+
+	firstTimes, err := s.repo.FirstPictureTimes()
+	if err != nil {
+		return err
+	}
+
+	// Folders take the earliest capture time found anywhere below them
+	var rollUp func(node *model.Hierarchy) (time.Time, bool)
+	rollUp = func(node *model.Hierarchy) (time.Time, bool) {
+		first, ok := firstTimes[node.ID]
+		for _, child := range node.Children {
+			if t, found := rollUp(child); found && (!ok || t.Before(first)) {
+				first, ok = t, true
+			}
+		}
+		if ok {
+			firstTimes[node.ID] = first
+		}
+		return first, ok
+	}
+	for _, node := range rootNodes {
+		rollUp(node)
+	}
+
+	var sortLevel func(nodes []*model.Hierarchy, mode model.SortMode)
+	sortLevel = func(nodes []*model.Hierarchy, mode model.SortMode) {
+		sortNodes(nodes, mode, firstTimes)
+		for _, node := range nodes {
+			sortLevel(node.Children, node.SortMode)
+		}
+	}
+	sortLevel(rootNodes, settings.RootSortMode)
+
+	return nil
+}
+
+// sortNodes orders siblings in place, falling back to the name for ties and unknown modes.
+func sortNodes(nodes []*model.Hierarchy, mode model.SortMode, firstTimes map[uint]time.Time) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+
+		switch mode {
+		case model.SortManual:
+			if a.Position != b.Position {
+				return a.Position < b.Position
+			}
+		case model.SortCreated:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+		case model.SortFirstPicture:
+			ta, okA := firstTimes[a.ID]
+			tb, okB := firstTimes[b.ID]
+			if okA != okB {
+				return okA // Nodes without pictures go last
+			}
+			if okA && !ta.Equal(tb) {
+				return ta.Before(tb)
+			}
+		}
+
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+}
+
+// processAndImportPictures handles file grouping, sorting, renaming, and copying. It returns the source
+// files it imported, also when it fails partway: the pictures imported until then stay in the album.
+func (s *HierarchyService) processAndImportPictures(sourceDir string, hierarchy *model.Hierarchy) (imported []string, err error) {
 	start := time.Now()
 
 	entries, err := os.ReadDir(sourceDir)
 	if err != nil {
 		slog.Error("IO error: failed to read source directory", "dir", sourceDir, "error", err)
-		return fmt.Errorf("failed to read source dir: %w", err)
+		return nil, fmt.Errorf("failed to read source dir: %w", err)
 	}
 
 	groupMap := make(map[string]*pictureGroup)
@@ -181,7 +876,7 @@ func (s *HierarchyService) processAndImportPictures(sourceDir string, hierarchy
 		info, err := e.Info()
 		if err != nil {
 			slog.Warn("Import warning: failed to get file info", "file", e.Name(), "error", err)
-			return fmt.Errorf("failed to get file info for %s: %w", e.Name(), err)
+			return nil, fmt.Errorf("failed to get file info for %s: %w", e.Name(), err)
 		}
 
 		ext := filepath.Ext(e.Name())
@@ -196,6 +891,7 @@ func (s *HierarchyService) processAndImportPictures(sourceDir string, hierarchy
 			Extension: ext,
 			FullPath:  filepath.Join(sourceDir, e.Name()),
 			ModTime:   info.ModTime(),
+			Size:      info.Size(),
 		})
 	}
 
@@ -207,29 +903,40 @@ func (s *HierarchyService) processAndImportPictures(sourceDir string, hierarchy
 		return getGroupTime(sortedGroups[i]).Before(getGroupTime(sortedGroups[j]))
 	})
 
+	// Templates may spell the subfolders differently, so match them case-insensitively
 	subFolderIDs := make(map[string]uint)
 	for _, sf := range hierarchy.SubFolders {
-		subFolderIDs[sf.Name] = sf.ID
+		subFolderIDs[strings.ToLower(sf.Name)] = sf.ID
+	}
+
+	fileCount := 0
+	for _, g := range sortedGroups {
+		fileCount += len(g.Files)
 	}
 
 	pictureCount := 0
+	job := startJob(s.broker, JobImport, fileCount, hierarchy.ID)
 
-	for i, group := range sortedGroups {
-		newIndexStr := fmt.Sprintf("%06d", i+1)
+	// Pictures imported before a failure stay, so the album changed either way
+	defer func() {
+		if len(imported) > 0 {
+			s.publishNodes(events.NodeUpdated, hierarchy.ID)
+		}
+	}()
 
-		for _, file := range group.Files {
-			upperExt := strings.ToUpper(file.Extension)
-			targetFolderName := "JPGs"
-			picType := "jpg"
+	// Albums that already hold pictures continue after their highest index
+	firstIndex := nextIndex(hierarchy)
 
-			if upperExt == ".ARW" || upperExt == ".CR2" || upperExt == ".NEF" {
-				targetFolderName = "RAWs"
-				picType = "raw"
-			}
+	for i, group := range sortedGroups {
+		newIndexStr := fmt.Sprintf("%06d", firstIndex+i)
+		capturedAt := getGroupTime(group)
 
-			sfID, ok := subFolderIDs[targetFolderName]
+		for _, file := range group.Files {
+			targetFolderName, picType := importTarget(file.Extension)
+			sfID, ok := subFolderIDs[strings.ToLower(targetFolderName)]
 			if !ok {
 				slog.Warn("Import warning: target subfolder not found", "folder", targetFolderName, "file", file.Name)
+				job.step(1)
 				continue
 			}
 
@@ -250,24 +957,50 @@ func (s *HierarchyService) processAndImportPictures(sourceDir string, hierarchy
 				Extension:   file.Extension,
 				Type:        picType,
 				Location:    destPath,
+				CapturedAt:  &capturedAt,
+				Size:        file.Size,
 				SubFolderID: sfID,
 			}
 
-			if err := copyFile(file.FullPath, destPath); err != nil {
+			// The album watcher waits for the row instead of importing the copy itself
+			release := ownChanges.hold(destPath)
+			hash, err := copyFile(file.FullPath, destPath)
+			if err != nil {
+				release()
 				slog.Error("IO error: file copy failed", "src", file.FullPath, "dst", destPath, "error", err)
-				return fmt.Errorf("failed to copy file %s: %w", file.Name, err)
+				err = fmt.Errorf("failed to copy file %s: %w", file.Name, err)
+				job.finish(err)
+				return imported, err
+			}
+			pic.Hash = hash
+
+			meta, exifTime, err := readMetadata(destPath)
+			if err != nil {
+				slog.Debug("Import: no EXIF metadata found", "file", file.Name, "error", err)
+			} else {
+				pic.Metadata = meta
+				if exifTime != nil {
+					pic.CapturedAt = exifTime
+				}
 			}
 
-			if err := s.pictureRepo.Create(&pic); err != nil {
-				return err
+			err = s.pictureRepo.Create(&pic)
+			release()
+			if err != nil {
+				job.finish(err)
+				return imported, err
 			}
 
 			pictureCount++
+			imported = append(imported, file.FullPath)
+			job.step(1)
+			publishPictureEvents(s.broker, s.pictureRepo, events.PictureAdded, pic.ID)
 
 			slog.Debug("File imported", "original", file.Name, "imported_as", newFileName)
 		}
 	}
 
+	job.finish(nil)
 	duration := time.Since(start)
 
 	slog.Info("Import complete",
@@ -277,13 +1010,22 @@ func (s *HierarchyService) processAndImportPictures(sourceDir string, hierarchy
 		"duration_msg", fmt.Sprintf("Pictures processed in: %.0fs (%s)", duration.Seconds(), duration.Round(time.Second)),
 	)
 
-	return nil
+	return imported, nil
+}
+
+// importTarget returns the subfolder and picture type an imported file with the extension gets.
+func importTarget(ext string) (folder, picType string) {
+	switch strings.ToUpper(ext) {
+	case ".ARW", ".CR2", ".NEF":
+		return rawFolder, "raw"
+	default:
+		return jpgFolder, "jpg"
+	}
 }
 
 func getGroupTime(g *pictureGroup) time.Time {
 	for _, f := range g.Files {
-		upper := strings.ToUpper(f.Extension)
-		if upper == ".ARW" || upper == ".CR2" || upper == ".NEF" {
+		if _, picType := importTarget(f.Extension); picType == "raw" {
 			return f.ModTime
 		}
 	}
@@ -293,19 +1035,40 @@ func getGroupTime(g *pictureGroup) time.Time {
 	return time.Now()
 }
 
-func copyFile(src, dst string) error {
+// copyFile copies src to dst and returns the SHA-256 of the copied bytes.
+func copyFile(src, dst string) (string, error) {
 	srcFile, err := os.Open(src)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer srcFile.Close()
 
 	dstFile, err := os.Create(dst)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer dstFile.Close()
 
-	_, err = io.Copy(dstFile, srcFile)
-	return err
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(dstFile, h), srcFile); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFile returns the SHA-256 of a file, hex encoded.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
@@ -0,0 +1,476 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/repository"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	hotFolderPollInterval = 2 * time.Second  // How often the inboxes are listed
+	defaultSettleTime     = 5 * time.Second  // How long a file must stay unchanged before it is imported
+	defaultSessionGap     = 30 * time.Minute // Quiet time that ends a session album
+	defaultNameRule       = "{date}"
+
+	// Working directories inside every inbox; the poller skips them like any other dot entry
+	importingDir = ".importing" // Files of the batch being imported
+	importedDir  = ".imported"  // Files kept after a successful import
+	failedDir    = ".failed"    // Files of batches that could not be imported
+)
+
+// ErrImportFolderMissing is returned when a batch's album lacks the subfolder its files are sorted into.
+var ErrImportFolderMissing = errors.New("album has no subfolder for the imported files")
+
+// HotFolderService imports the files that appear in the inbox folders configured in the settings.
+// Files are grouped by base name like a manual import, so a RAW and its JPG always land together.
+type HotFolderService struct {
+	hierarchy    *HierarchyService
+	settingsRepo *repository.SettingsRepository
+
+	seen        map[string]map[string]hotFile // Files per inbox and the last change noticed
+	sessions    map[string]hotSession         // Open session album per inbox
+	unavailable map[string]bool               // Inboxes already reported as unreadable
+}
+
+func NewHotFolderService(hierarchy *HierarchyService, settingsRepo *repository.SettingsRepository) *HotFolderService {
+	return &HotFolderService{
+		hierarchy:    hierarchy,
+		settingsRepo: settingsRepo,
+		seen:         make(map[string]map[string]hotFile),
+		sessions:     make(map[string]hotSession),
+		unavailable:  make(map[string]bool),
+	}
+}
+
+type hotFile struct {
+	size      int64
+	modTime   time.Time
+	changedAt time.Time
+}
+
+type hotSession struct {
+	albumID uint
+	last    time.Time // Time of the last import into the album
+}
+
+// Run polls the inboxes until ctx is cancelled. The hot_folders setting is re-read on every poll,
+// so inboxes can be added or removed without a restart.
+func (s *HotFolderService) Run(ctx context.Context) {
+	recovered := make(map[string]bool)
+
+	ticker := time.NewTicker(hotFolderPollInterval)
+	defer ticker.Stop()
+
+	for {
+		settings, err := s.settingsRepo.GetSettings()
+		if err != nil {
+			slog.Error("Service error: failed to load settings for hot folders", "error", err)
+		} else {
+			active := make(map[string]bool)
+			for _, hf := range settings.HotFolders {
+				active[hf.Path] = true
+
+				// Batches interrupted by a shutdown go back into the inbox and are imported again
+				if !recovered[hf.Path] && recoverImporting(hf.Path) {
+					recovered[hf.Path] = true
+				}
+				s.poll(hf, time.Now())
+			}
+
+			for path := range s.seen {
+				if !active[path] {
+					delete(s.seen, path)
+					delete(s.sessions, path)
+					delete(s.unavailable, path)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll notices new and changed files in one inbox and imports the groups that settled.
+func (s *HotFolderService) poll(hf model.HotFolder, now time.Time) {
+	entries, err := os.ReadDir(hf.Path)
+	if err != nil {
+		// Card readers and network shares come and go, so only the first failure is logged
+		if !s.unavailable[hf.Path] {
+			slog.Warn("IO warning: hot folder is not available", "path", hf.Path, "error", err)
+			s.unavailable[hf.Path] = true
+		}
+		return
+	}
+	if s.unavailable[hf.Path] {
+		slog.Info("Hot folder available again", "path", hf.Path)
+		delete(s.unavailable, hf.Path)
+	}
+
+	previous := s.seen[hf.Path]
+	current := make(map[string]hotFile)
+	for _, e := range entries {
+		if e.IsDir() || ignoredByWatcher(e.Name()) {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		f := hotFile{size: info.Size(), modTime: info.ModTime(), changedAt: now}
+		if prev, ok := previous[e.Name()]; ok && prev.size == f.size && prev.modTime.Equal(f.modTime) {
+			f.changedAt = prev.changedAt
+		}
+		current[e.Name()] = f
+	}
+	s.seen[hf.Path] = current
+
+	settle := defaultSettleTime
+	if hf.SettleSeconds > 0 {
+		settle = time.Duration(hf.SettleSeconds) * time.Second
+	}
+
+	// A group is only ready when every file sharing its base name has settled
+	groups := make(map[string]*pictureGroup)
+	busy := make(map[string]bool)
+	for name, f := range current {
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		if now.Sub(f.changedAt) < settle {
+			busy[base] = true
+		}
+
+		if _, ok := groups[base]; !ok {
+			groups[base] = &pictureGroup{BaseName: base}
+		}
+		groups[base].Files = append(groups[base].Files, fileEntry{
+			Name:      name,
+			Extension: ext,
+			FullPath:  filepath.Join(hf.Path, name),
+			ModTime:   f.modTime,
+			Size:      f.size,
+		})
+	}
+
+	var ready []*pictureGroup
+	for base, g := range groups {
+		if !busy[base] {
+			ready = append(ready, g)
+		}
+	}
+	if len(ready) == 0 {
+		return
+	}
+
+	sort.Slice(ready, func(i, j int) bool {
+		return getGroupTime(ready[i]).Before(getGroupTime(ready[j]))
+	})
+
+	for i, batch := range s.batches(hf, ready) {
+		stamp := fmt.Sprintf("%s-%d", now.Format("20060102-150405"), i+1)
+		if err := s.importBatch(hf, batch, stamp, now); err != nil {
+			slog.Error("Service error: hot folder import failed", "inbox", hf.Path, "album", batch.name, "error", err)
+		}
+		for _, g := range batch.groups {
+			for _, f := range g.Files {
+				delete(current, f.Name)
+			}
+		}
+	}
+}
+
+// hotBatch holds the groups that go into the same album.
+type hotBatch struct {
+	name   string
+	groups []*pictureGroup
+}
+
+// batches splits the ready groups by album. Rolling inboxes name the album after each group's capture
+// time, so a card holding several days fills several albums. A session album takes everything at once.
+func (s *HotFolderService) batches(hf model.HotFolder, ready []*pictureGroup) []*hotBatch {
+	if hf.Mode == model.HotFolderSession {
+		return []*hotBatch{{
+			name:   expandNameRule(nameRule(hf), getGroupTime(ready[0])),
+			groups: ready,
+		}}
+	}
+
+	var batches []*hotBatch
+	byName := make(map[string]*hotBatch)
+	for _, g := range ready {
+		name := expandNameRule(nameRule(hf), getGroupTime(g))
+		b, ok := byName[name]
+		if !ok {
+			b = &hotBatch{name: name}
+			byName[name] = b
+			batches = append(batches, b)
+		}
+		b.groups = append(b.groups, g)
+	}
+	return batches
+}
+
+// importBatch moves the batch into a staging directory, imports it through the regular pipeline
+// and then keeps or deletes the originals. Failed batches are parked in the failed directory.
+func (s *HotFolderService) importBatch(hf model.HotFolder, batch *hotBatch, stamp string, now time.Time) error {
+	staging := filepath.Join(hf.Path, importingDir, stamp)
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		slog.Error("IO error: failed to create hot folder staging directory", "path", staging, "error", err)
+		return err
+	}
+
+	for _, g := range batch.groups {
+		for _, f := range g.Files {
+			if err := os.Rename(f.FullPath, filepath.Join(staging, f.Name)); err != nil {
+				slog.Error("IO error: failed to stage hot folder file", "path", f.FullPath, "error", err)
+				s.park(hf.Path, staging, failedDir, stamp)
+				return err
+			}
+		}
+	}
+
+	album, err := s.targetAlbum(hf, batch.name, now)
+	if err == nil {
+		err = checkImportFolders(album, batch.groups)
+	}
+	if err == nil {
+		slog.Info("Starting hot folder import", "inbox", hf.Path, "album", album.Name, "pictures", len(batch.groups))
+		var imported []string
+		imported, err = s.hierarchy.processAndImportPictures(staging, album)
+		s.hierarchy.writeManifests(album.ID)
+
+		// The pictures imported before a failure stay in the album, so only the rest goes to .failed
+		if err != nil && len(imported) > 0 {
+			s.setAside(hf, staging, imported, stamp)
+		}
+	}
+	if err != nil {
+		s.park(hf.Path, staging, failedDir, stamp)
+		return err
+	}
+
+	if hf.DeleteImported {
+		if err := os.RemoveAll(staging); err != nil {
+			slog.Warn("IO warning: failed to delete imported hot folder files", "path", staging, "error", err)
+		}
+	} else {
+		s.park(hf.Path, staging, importedDir, stamp)
+	}
+
+	if hf.Mode == model.HotFolderSession {
+		s.sessions[hf.Path] = hotSession{albumID: album.ID, last: now}
+	}
+
+	slog.Info("Hot folder import complete", "inbox", hf.Path, "album", album.Name, "album_id", album.ID)
+	return nil
+}
+
+// targetAlbum returns the album a batch is imported into, creating it when needed.
+func (s *HotFolderService) targetAlbum(hf model.HotFolder, name string, now time.Time) (*model.Hierarchy, error) {
+	var parentID *uint
+	if hf.FolderID != 0 {
+		parentID = &hf.FolderID
+	}
+
+	if hf.Mode == model.HotFolderSession {
+		gap := defaultSessionGap
+		if hf.GapMinutes > 0 {
+			gap = time.Duration(hf.GapMinutes) * time.Minute
+		}
+
+		if session, ok := s.sessions[hf.Path]; ok && now.Sub(session.last) <= gap {
+			album, err := s.hierarchy.loadAlbum(session.albumID)
+			if err == nil {
+				return album, nil
+			}
+			if !errors.Is(err, ErrNodeNotFound) {
+				return nil, err
+			}
+			// The album was deleted in the meantime, so the session starts over
+		}
+
+		unique, err := s.uniqueAlbumName(parentID, name)
+		if err != nil {
+			return nil, err
+		}
+		return s.createAlbum(hf, unique)
+	}
+
+	children, err := s.hierarchy.repo.FindChildren(parentID)
+	if err != nil {
+		slog.Error("Service error: failed to load hot folder destination", "folder_id", hf.FolderID, "error", err)
+		return nil, err
+	}
+	for _, child := range children {
+		if child.Type == model.TypeAlbum && child.Name == name {
+			return s.hierarchy.loadAlbum(child.ID)
+		}
+	}
+
+	return s.createAlbum(hf, name)
+}
+
+func (s *HotFolderService) createAlbum(hf model.HotFolder, name string) (*model.Hierarchy, error) {
+	album, err := s.hierarchy.CreateNode(CreateNodeRequest{
+		ParentID: hf.FolderID,
+		Name:     name,
+		Type:     model.TypeAlbum,
+		Template: hf.Template,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Hot folder created album", "inbox", hf.Path, "album", album.Name, "album_id", album.ID)
+	return s.hierarchy.loadAlbum(album.ID)
+}
+
+// uniqueAlbumName appends " (2)", " (3)", ... until no sibling album uses the name.
+func (s *HotFolderService) uniqueAlbumName(parentID *uint, name string) (string, error) {
+	candidate := name
+	for n := 2; ; n++ {
+		exists, err := s.hierarchy.repo.FindDuplicate(parentID, candidate, model.TypeAlbum, 0)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s (%d)", name, n)
+	}
+}
+
+// park moves a staging directory into one of the inbox's working directories.
+func (s *HotFolderService) park(inbox, staging, dir, stamp string) {
+	target := filepath.Join(inbox, dir, stamp)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+		if err = os.Rename(staging, target); err == nil {
+			return
+		}
+	}
+	slog.Warn("IO warning: hot folder files left in staging", "path", staging, "wanted", target)
+}
+
+// setAside takes the files of a failed batch that were imported out of staging, deleting them or
+// keeping them with the imported files like a successful batch would.
+func (s *HotFolderService) setAside(hf model.HotFolder, staging string, imported []string, stamp string) {
+	target := filepath.Join(hf.Path, importedDir, stamp)
+	if !hf.DeleteImported {
+		if err := os.MkdirAll(target, 0755); err != nil {
+			slog.Warn("IO warning: imported hot folder files left in staging", "path", staging, "error", err)
+			return
+		}
+	}
+
+	for _, path := range imported {
+		var err error
+		if hf.DeleteImported {
+			err = os.Remove(path)
+		} else {
+			err = os.Rename(path, filepath.Join(target, filepath.Base(path)))
+		}
+		if err != nil {
+			slog.Warn("IO warning: failed to set aside imported hot folder file", "path", path, "error", err)
+		}
+	}
+}
+
+// checkImportFolders makes sure the album has a subfolder for every file of the batch. A batch is
+// imported as a whole, so it fails before any file is copied instead of skipping the files it cannot place.
+func checkImportFolders(album *model.Hierarchy, groups []*pictureGroup) error {
+	var missing []string
+	for _, g := range groups {
+		for _, f := range g.Files {
+			folder, _ := importTarget(f.Extension)
+			if !containsFold(missing, folder) && !hasSubFolder(album, folder) {
+				missing = append(missing, folder)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		slog.Warn("Hot folder import rejected: target subfolder not found", "album", album.Name, "folders", missing)
+		return fmt.Errorf("%w: %s", ErrImportFolderMissing, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func hasSubFolder(album *model.Hierarchy, name string) bool {
+	for _, sf := range album.SubFolders {
+		if strings.EqualFold(sf.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// recoverImporting moves files of unfinished batches back into the inbox. It reports false
+// while the inbox cannot be read, so recovery is tried again on the next poll.
+func recoverImporting(inbox string) bool {
+	root := filepath.Join(inbox, importingDir)
+	batches, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		_, err = os.Stat(inbox)
+		return err == nil
+	}
+	if err != nil {
+		return false
+	}
+
+	recovered := 0
+	for _, b := range batches {
+		dir := filepath.Join(root, b.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			dst := filepath.Join(inbox, f.Name())
+			if _, err := os.Stat(dst); err == nil {
+				continue
+			}
+			if err := os.Rename(filepath.Join(dir, f.Name()), dst); err != nil {
+				slog.Warn("IO warning: failed to recover hot folder file", "path", dst, "error", err)
+				continue
+			}
+			recovered++
+		}
+		_ = os.Remove(dir) // Only succeeds once the batch is empty
+	}
+
+	if recovered > 0 {
+		slog.Info("Hot folder recovered unfinished imports", "inbox", inbox, "files", recovered)
+	}
+	return true
+}
+
+func nameRule(hf model.HotFolder) string {
+	if hf.NameRule == "" {
+		return defaultNameRule
+	}
+	return hf.NameRule
+}
+
+// expandNameRule fills the placeholders of an album name rule: {date}, {year}, {month}, {day} and {time}.
+func expandNameRule(rule string, t time.Time) string {
+	return strings.NewReplacer(
+		"{date}", t.Format("2006-01-02"),
+		"{year}", t.Format("2006"),
+		"{month}", t.Format("01"),
+		"{day}", t.Format("02"),
+		"{time}", t.Format("15-04"),
+	).Replace(rule)
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"log/slog"
+	"picturebot-backend/internal/events"
+	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/repository"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job kinds reported in job.progress events.
+const (
+	JobImport  = "import"
+	JobScrub   = "scrub"
+	JobRebuild = "rebuild"
+	JobExport  = "export"
+)
+
+// Job states.
+const (
+	JobRunning  = "running"
+	JobFinished = "finished"
+	JobFailed   = "failed"
+)
+
+// jobProgressInterval limits how often a running job publishes its progress.
+const jobProgressInterval = 500 * time.Millisecond
+
+// Job is the data of a job.progress event. Total is 0 while the amount of work is unknown.
+type Job struct {
+	ID      string `json:"id"`
+	Kind    string `json:"kind"`
+	State   string `json:"state"`
+	Done    int    `json:"done"`
+	Total   int    `json:"total"`
+	AlbumID uint   `json:"album_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	broker      *events.Broker
+	publishedAt time.Time
+	observe     func(Job) // Also receives every published state, e.g. to answer status requests
+}
+
+// startJob announces a job and returns it for progress reporting.
+func startJob(broker *events.Broker, kind string, total int, albumID uint) *Job {
+	j := &Job{
+		ID:      uuid.NewString(),
+		Kind:    kind,
+		State:   JobRunning,
+		Total:   total,
+		AlbumID: albumID,
+		broker:  broker,
+	}
+	j.publish()
+	return j
+}
+
+// step records finished work, publishing at most every jobProgressInterval.
+func (j *Job) step(n int) {
+	j.Done += n
+	if time.Since(j.publishedAt) >= jobProgressInterval {
+		j.publish()
+	}
+}
+
+// finish publishes the final state of the job.
+func (j *Job) finish(err error) {
+	j.State = JobFinished
+	if err != nil {
+		j.State = JobFailed
+		j.Error = err.Error()
+	}
+	j.publish()
+}
+
+func (j *Job) publish() {
+	j.publishedAt = time.Now()
+	progress := *j // Subscribers read the copy while the job goes on
+	j.broker.Publish(events.JobProgress, progress)
+	if j.observe != nil {
+		j.observe(progress)
+	}
+}
+
+// DeletedNodes is the data of a node.deleted event.
+type DeletedNodes struct {
+	ID  uint   `json:"id"`  // The node the delete was requested for
+	IDs []uint `json:"ids"` // Every node removed with it
+}
+
+// PicturesChanged is the data of a pictures.updated event.
+type PicturesChanged struct {
+	PictureIDs []uint `json:"picture_ids"`
+	AlbumIDs   []uint `json:"album_ids"`
+}
+
+// publishNodes reloads the given nodes and publishes an event for each. Nodes that cannot be loaded are skipped.
+func (s *HierarchyService) publishNodes(eventType string, ids ...uint) {
+	publishNodeEvents(s.broker, s.repo, eventType, ids...)
+}
+
+// publishNodeEvents is publishNodes for services that share the hierarchy repository.
+func publishNodeEvents(broker *events.Broker, repo *repository.HierarchyRepository, eventType string, ids ...uint) {
+	if broker == nil {
+		return
+	}
+
+	for _, id := range ids {
+		node, err := repo.FindByID(id)
+		if err != nil {
+			slog.Warn("Service warning: failed to load node for event", "id", id, "type", eventType, "error", err)
+			continue
+		}
+		node.Children = []*model.Hierarchy{}
+		broker.Publish(eventType, node)
+	}
+}
+
+// publishPictureEvents reloads the given pictures with their details and publishes an event for each.
+// Pictures that cannot be loaded are skipped.
+func publishPictureEvents(broker *events.Broker, repo *repository.PictureRepository, eventType string, ids ...uint) {
+	if broker == nil {
+		return
+	}
+
+	for _, id := range ids {
+		picture, err := repo.FindByID(id)
+		if err != nil {
+			slog.Warn("Service warning: failed to load picture for event", "id", id, "type", eventType, "error", err)
+			continue
+		}
+		broker.Publish(eventType, picture)
+	}
+}
@@ -0,0 +1,480 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"picturebot-backend/internal/events"
+	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Issue types reported by the library check.
+const (
+	IssueMissingFile      = "missing_file"      // A picture's file is gone
+	IssueUntrackedFile    = "untracked_file"    // A file in an album directory has no picture
+	IssueSizeMismatch     = "size_mismatch"     // The file size differs from the catalog
+	IssueHashMismatch     = "hash_mismatch"     // The file content differs from the catalog
+	IssueMissingDirectory = "missing_directory" // A subfolder's directory is gone
+	IssueOrphanDirectory  = "orphan_directory"  // A UUID directory belongs to no album
+)
+
+// Repair actions offered per issue. The first action of an issue is its default.
+const (
+	RepairRemoveRecord    = "remove_record"    // Forget the picture
+	RepairImport          = "import"           // Add the file to the catalog
+	RepairTrash           = "trash"            // Move the file or directory to the library trash
+	RepairUpdateRecord    = "update_record"    // Accept the size and hash found on disk
+	RepairCreateDirectory = "create_directory" // Recreate the missing directory
+)
+
+var ErrIssueResolved = errors.New("issue no longer present")
+
+var repairActions = map[string][]string{
+	IssueMissingFile:      {RepairRemoveRecord},
+	IssueUntrackedFile:    {RepairImport, RepairTrash},
+	IssueSizeMismatch:     {RepairUpdateRecord},
+	IssueHashMismatch:     {RepairUpdateRecord},
+	IssueMissingDirectory: {RepairCreateDirectory},
+	IssueOrphanDirectory:  {RepairTrash},
+}
+
+// LibraryService compares the catalog with the files in the library root.
+type LibraryService struct {
+	hierarchyRepo *repository.HierarchyRepository
+	pictureRepo   *repository.PictureRepository
+	subFolderRepo *repository.SubFolderRepository
+	tagRepo       *repository.TagRepository
+	broker        *events.Broker
+}
+
+func NewLibraryService(hierarchyRepo *repository.HierarchyRepository, pictureRepo *repository.PictureRepository, subFolderRepo *repository.SubFolderRepository, tagRepo *repository.TagRepository, broker *events.Broker) *LibraryService {
+	return &LibraryService{
+		hierarchyRepo: hierarchyRepo,
+		pictureRepo:   pictureRepo,
+		subFolderRepo: subFolderRepo,
+		tagRepo:       tagRepo,
+		broker:        broker,
+	}
+}
+
+// CheckIssue is a single difference between the catalog and the disk.
+type CheckIssue struct {
+	Type        string   `json:"type"`
+	Path        string   `json:"path"`
+	PictureID   uint     `json:"picture_id,omitempty"`
+	SubFolderID uint     `json:"sub_folder_id,omitempty"`
+	Detail      string   `json:"detail"`
+	Repairs     []string `json:"repairs"`
+}
+
+// CheckReport is the result of a library check.
+type CheckReport struct {
+	StartedAt    time.Time    `json:"started_at"`
+	Duration     string       `json:"duration"`
+	Hashed       bool         `json:"hashed"`
+	FilesChecked int          `json:"files_checked"`
+	Issues       []CheckIssue `json:"issues"`
+}
+
+// RepairRequest applies one repair action to an issue from a check report.
+type RepairRequest struct {
+	Type        string `json:"type"`
+	Path        string `json:"path"`
+	PictureID   uint   `json:"picture_id"`
+	SubFolderID uint   `json:"sub_folder_id"`
+	Action      string `json:"action"` // Empty applies the default action
+}
+
+// RepairResult reports the outcome of one repair.
+type RepairResult struct {
+	RepairRequest
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Check walks the library root and reports every difference with the catalog.
+// Hashing every file is slow, so content is only compared when withHash is set.
+func (s *LibraryService) Check(withHash bool) (*CheckReport, error) {
+	report := &CheckReport{StartedAt: time.Now(), Hashed: withHash, Issues: []CheckIssue{}}
+
+	nodes, err := s.hierarchyRepo.FindAllNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	subFolders, err := s.subFolderRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	pictures, err := s.pictureRepo.FindAllFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	albums := make(map[string]bool)
+	for _, n := range nodes {
+		if n.Type == model.TypeAlbum && n.UUID != "" {
+			albums[n.UUID] = true
+		}
+	}
+
+	// Known files and subfolder directories
+	tracked := make(map[string]bool, len(pictures))
+	for _, p := range pictures {
+		tracked[filepath.Clean(p.Location)] = true
+	}
+
+	subFolderDirs := make(map[string]uint, len(subFolders))
+	for _, sf := range subFolders {
+		if sf.Location == "" {
+			continue
+		}
+		subFolderDirs[filepath.Clean(sf.Location)] = sf.ID
+
+		if info, err := os.Stat(sf.Location); err != nil || !info.IsDir() {
+			report.add(CheckIssue{Type: IssueMissingDirectory, Path: sf.Location, SubFolderID: sf.ID, Detail: fmt.Sprintf("subfolder %s has no directory", sf.Name)})
+		}
+	}
+
+	// Every picture must exist with the recorded size and content
+	for _, p := range pictures {
+		report.FilesChecked++
+
+		if issue := checkPictureFile(p, withHash); issue != nil {
+			report.add(*issue)
+		}
+	}
+
+	// Every file below an album directory must be known, every UUID directory must be an album
+	entries, err := os.ReadDir(libraryRoot)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == trashDir {
+			continue
+		}
+
+		dir := filepath.Join(libraryRoot, e.Name())
+		if !albums[e.Name()] {
+			if _, err := uuid.Parse(e.Name()); err == nil {
+				detail := "directory does not belong to any album"
+				if _, err := os.Stat(filepath.Join(dir, manifestFile)); err == nil {
+					detail += ", its manifest can restore it with a rebuild"
+				}
+				report.add(CheckIssue{Type: IssueOrphanDirectory, Path: dir, Detail: detail})
+			}
+			continue
+		}
+
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || tracked[filepath.Clean(path)] || path == filepath.Join(dir, manifestFile) {
+				return nil
+			}
+
+			issue := CheckIssue{Type: IssueUntrackedFile, Path: path, Detail: "file is not in the catalog"}
+			if id, ok := subFolderDirs[filepath.Dir(path)]; ok {
+				issue.SubFolderID = id
+			} else {
+				// Only files inside a subfolder can be imported
+				issue.Repairs = []string{RepairTrash}
+			}
+			report.add(issue)
+			return nil
+		})
+		if err != nil {
+			slog.Error("IO error: failed to walk album directory", "path", dir, "error", err)
+			return nil, err
+		}
+	}
+
+	report.Duration = time.Since(report.StartedAt).Round(time.Millisecond).String()
+	slog.Info("Library check complete", "files", report.FilesChecked, "issues", len(report.Issues), "duration", report.Duration)
+
+	return report, nil
+}
+
+func (r *CheckReport) add(issue CheckIssue) {
+	if issue.Repairs == nil {
+		issue.Repairs = repairActions[issue.Type]
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+// checkPictureFile compares one picture with its file and returns the issue found, if any.
+func checkPictureFile(p model.Picture, withHash bool) *CheckIssue {
+	info, err := os.Stat(p.Location)
+	if err != nil {
+		return &CheckIssue{Type: IssueMissingFile, Path: p.Location, PictureID: p.ID, SubFolderID: p.SubFolderID, Detail: "file does not exist"}
+	}
+
+	// Pictures imported before sizes were recorded have no size to compare
+	if p.Size > 0 && info.Size() != p.Size {
+		return &CheckIssue{Type: IssueSizeMismatch, Path: p.Location, PictureID: p.ID, SubFolderID: p.SubFolderID,
+			Detail: fmt.Sprintf("catalog has %d bytes, disk has %d", p.Size, info.Size())}
+	}
+
+	if withHash && p.Hash != "" {
+		hash, err := hashFile(p.Location)
+		if err != nil {
+			return &CheckIssue{Type: IssueMissingFile, Path: p.Location, PictureID: p.ID, SubFolderID: p.SubFolderID, Detail: "file cannot be read: " + err.Error()}
+		}
+		if hash != p.Hash {
+			return &CheckIssue{Type: IssueHashMismatch, Path: p.Location, PictureID: p.ID, SubFolderID: p.SubFolderID, Detail: "file content changed since import"}
+		}
+	}
+
+	return nil
+}
+
+// Repair applies the requested actions one by one. Each issue is verified again first,
+// so repairs from an outdated report are skipped instead of doing damage.
+func (s *LibraryService) Repair(reqs []RepairRequest) []RepairResult {
+	results := make([]RepairResult, 0, len(reqs))
+
+	for _, req := range reqs {
+		if req.Action == "" && len(repairActions[req.Type]) > 0 {
+			req.Action = repairActions[req.Type][0]
+		}
+
+		result := RepairResult{RepairRequest: req}
+		if err := s.repair(req); err != nil {
+			slog.Warn("Library repair failed", "type", req.Type, "path", req.Path, "action", req.Action, "error", err)
+			result.Error = err.Error()
+		} else {
+			slog.Info("Library issue repaired", "type", req.Type, "path", req.Path, "action", req.Action)
+			result.Applied = true
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func (s *LibraryService) repair(req RepairRequest) error {
+	allowed := false
+	for _, a := range repairActions[req.Type] {
+		allowed = allowed || a == req.Action
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %q cannot repair %q", ErrInvalidUpdate, req.Action, req.Type)
+	}
+
+	switch req.Type {
+	case IssueMissingFile, IssueSizeMismatch, IssueHashMismatch:
+		return s.repairPicture(req)
+	case IssueUntrackedFile:
+		return s.repairUntracked(req)
+	case IssueMissingDirectory:
+		sub, err := s.subFolderRepo.FindByID(req.SubFolderID)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(sub.Location); err == nil {
+			return ErrIssueResolved
+		}
+		return os.MkdirAll(sub.Location, 0755)
+	case IssueOrphanDirectory:
+		// Like the check, only UUID directories directly in the library root qualify
+		name := filepath.Base(req.Path)
+		if filepath.Dir(filepath.Clean(req.Path)) != filepath.Clean(libraryRoot) || name == trashDir {
+			return fmt.Errorf("%w: %s is not a library directory", ErrInvalidUpdate, req.Path)
+		}
+		if _, err := uuid.Parse(name); err != nil {
+			return fmt.Errorf("%w: %s is not an album directory", ErrInvalidUpdate, req.Path)
+		}
+		if _, err := s.hierarchyRepo.FindByUUID(filepath.Base(req.Path)); err == nil {
+			return ErrIssueResolved
+		}
+		_, err := moveToTrash(req.Path)
+		return err
+	}
+
+	return nil
+}
+
+func (s *LibraryService) repairPicture(req RepairRequest) error {
+	picture, err := s.pictureRepo.FindByID(req.PictureID)
+	if err != nil {
+		return ErrIssueResolved
+	}
+
+	issue := checkPictureFile(*picture, req.Type == IssueHashMismatch)
+	if issue == nil || issue.Type != req.Type {
+		return ErrIssueResolved
+	}
+
+	defer refreshManifests(s.hierarchyRepo, picture.SubFolder.HierarchyID)
+
+	switch req.Action {
+	case RepairRemoveRecord:
+		if err := s.pictureRepo.Delete([]uint{picture.ID}); err != nil {
+			return err
+		}
+		publishNodeEvents(s.broker, s.hierarchyRepo, events.NodeUpdated, picture.SubFolder.HierarchyID)
+		return nil
+	default:
+		info, err := os.Stat(picture.Location)
+		if err != nil {
+			return err
+		}
+		hash, err := hashFile(picture.Location)
+		if err != nil {
+			return err
+		}
+		if err := s.pictureRepo.UpdateChecksum(picture.ID, info.Size(), hash); err != nil {
+			return err
+		}
+		publishPictureEvents(s.broker, s.pictureRepo, events.PictureUpdated, picture.ID)
+		return nil
+	}
+}
+
+func (s *LibraryService) repairUntracked(req RepairRequest) error {
+	path := filepath.Clean(req.Path)
+	root := filepath.Clean(libraryRoot)
+	if !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return fmt.Errorf("%w: %s is outside the library", ErrInvalidUpdate, req.Path)
+	}
+
+	// The trash and the album manifests are never reported as untracked
+	rel, _ := filepath.Rel(root, path)
+	parts := strings.Split(rel, string(filepath.Separator))
+	if parts[0] == trashDir {
+		return fmt.Errorf("%w: %s is in the trash", ErrInvalidUpdate, req.Path)
+	}
+	if len(parts) == 2 && parts[1] == manifestFile {
+		return fmt.Errorf("%w: %s is an album manifest", ErrInvalidUpdate, req.Path)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return ErrIssueResolved
+	}
+
+	pictures, err := s.pictureRepo.FindAllFiles()
+	if err != nil {
+		return err
+	}
+	for _, p := range pictures {
+		if filepath.Clean(p.Location) == path {
+			return ErrIssueResolved
+		}
+	}
+
+	if req.Action == RepairTrash {
+		_, err := moveToTrash(path)
+		return err
+	}
+
+	sub, err := s.subFolderRepo.FindByID(req.SubFolderID)
+	if err != nil || filepath.Clean(sub.Location) != filepath.Dir(path) {
+		return fmt.Errorf("%w: file is not inside subfolder %d", ErrInvalidUpdate, req.SubFolderID)
+	}
+
+	defer refreshManifests(s.hierarchyRepo, sub.HierarchyID)
+
+	added, err := s.importFile(sub, path)
+	if err != nil {
+		return err
+	}
+	publishPictureEvents(s.broker, s.pictureRepo, events.PictureAdded, added.ID)
+	return nil
+}
+
+// importFile adds a file that already sits in a subfolder to the catalog. Names starting with an index,
+// like edits exported as 000012-edit.jpg, keep their name and join that shot. Other files that do not
+// follow the index naming get the album's next index and are renamed to match.
+func (s *LibraryService) importFile(sub *model.SubFolder, path string) (*model.Picture, error) {
+	ext := filepath.Ext(path)
+	index := strings.TrimSuffix(filepath.Base(path), ext)
+
+	if prefix, ok := shotPrefix(index); ok {
+		index = prefix
+	} else if _, err := strconv.Atoi(index); err != nil {
+		album, err := s.hierarchyRepo.FindByIDWithPictures(sub.HierarchyID)
+		if err != nil {
+			return nil, err
+		}
+
+		index = fmt.Sprintf("%06d", nextIndex(album))
+		renamed := filepath.Join(sub.Location, index+ext)
+		if _, err := os.Stat(renamed); err == nil {
+			return nil, fmt.Errorf("cannot rename to %s, it already exists", renamed)
+		}
+		if err := os.Rename(path, renamed); err != nil {
+			return nil, err
+		}
+		path = renamed
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := hashFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	_, picType := importTarget(ext)
+
+	capturedAt := info.ModTime()
+	pic := model.Picture{
+		FileName:    filepath.Base(path),
+		Index:       index,
+		Extension:   ext,
+		Type:        picType,
+		Location:    path,
+		CapturedAt:  &capturedAt,
+		Size:        info.Size(),
+		Hash:        hash,
+		SubFolderID: sub.ID,
+	}
+
+	if meta, exifTime, err := readMetadata(path); err == nil {
+		pic.Metadata = meta
+		if exifTime != nil {
+			pic.CapturedAt = exifTime
+		}
+	}
+
+	if err := s.pictureRepo.Create(&pic); err != nil {
+		return nil, err
+	}
+
+	return &pic, nil
+}
+
+// shotPrefix returns the index a derived file name starts with, e.g. "000012" for "000012-edit".
+func shotPrefix(name string) (string, bool) {
+	const width = 6
+	if len(name) <= width {
+		return "", false
+	}
+
+	for _, r := range name[:width] {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+	if r := name[width]; r >= '0' && r <= '9' {
+		return "", false
+	}
+
+	return name[:width], true
+}
@@ -0,0 +1,468 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"picturebot-backend/internal/events"
+	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/repository"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// manifestFile is written into every album directory so the catalog can be rebuilt from the library.
+const manifestFile = "picturebot.json"
+
+const manifestVersion = 1
+
+// AlbumManifest describes an album in its own directory. The directory name is the album's UUID.
+type AlbumManifest struct {
+	Version   int       `json:"version"`
+	UUID      string    `json:"uuid"`
+	Name      string    `json:"name"`
+	Path      []string  `json:"path"` // Names of the parent folders, from the root down
+	CreatedAt time.Time `json:"created_at"`
+	WrittenAt time.Time `json:"written_at"`
+	Cover     string    `json:"cover,omitempty"` // Subfolder and file name of the chosen cover, e.g. "JPGs/000012.jpg"
+
+	Description string            `json:"description,omitempty"`
+	EventStart  *time.Time        `json:"event_start,omitempty"`
+	EventEnd    *time.Time        `json:"event_end,omitempty"`
+	Location    string            `json:"location,omitempty"`
+	Client      string            `json:"client,omitempty"`
+	Contact     string            `json:"contact,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+
+	SubFolders []ManifestSubFolder `json:"sub_folders"`
+}
+
+type ManifestSubFolder struct {
+	Name     string            `json:"name"`
+	Pictures []ManifestPicture `json:"pictures"`
+}
+
+type ManifestPicture struct {
+	FileName   string                 `json:"file_name"`
+	Index      string                 `json:"index"`
+	Extension  string                 `json:"extension"`
+	Type       string                 `json:"type"`
+	Rating     int                    `json:"rating,omitempty"`
+	Flag       string                 `json:"flag,omitempty"`
+	CapturedAt *time.Time             `json:"captured_at,omitempty"`
+	Size       int64                  `json:"size"`
+	Hash       string                 `json:"hash,omitempty"`
+	Metadata   *model.PictureMetadata `json:"metadata,omitempty"`
+	Tags       []string               `json:"tags,omitempty"` // Tag paths
+}
+
+// buildManifest collects the catalog state of an album.
+func buildManifest(repo *repository.HierarchyRepository, id uint) (*AlbumManifest, error) {
+	album, err := repo.FindWithContents(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ancestors, err := repo.FindAncestors(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &AlbumManifest{
+		Version:     manifestVersion,
+		UUID:        album.UUID,
+		Name:        album.Name,
+		Path:        []string{},
+		CreatedAt:   album.CreatedAt,
+		WrittenAt:   time.Now(),
+		Description: album.Description,
+		EventStart:  album.EventStart,
+		EventEnd:    album.EventEnd,
+		Location:    album.Location,
+		Client:      album.Client,
+		Contact:     album.Contact,
+		SubFolders:  []ManifestSubFolder{},
+	}
+
+	// The last ancestor is the album itself
+	for _, a := range ancestors {
+		if a.ID != album.ID {
+			m.Path = append(m.Path, a.Name)
+		}
+	}
+
+	if len(album.Attributes) > 0 {
+		m.Attributes = make(map[string]string, len(album.Attributes))
+		for _, attr := range album.Attributes {
+			m.Attributes[attr.Key] = attr.Value
+		}
+	}
+
+	for _, sf := range album.SubFolders {
+		msf := ManifestSubFolder{Name: sf.Name, Pictures: []ManifestPicture{}}
+
+		for _, p := range sf.Pictures {
+			if album.CoverPictureID != nil && *album.CoverPictureID == p.ID {
+				m.Cover = sf.Name + "/" + p.FileName
+			}
+
+			mp := ManifestPicture{
+				FileName:   p.FileName,
+				Index:      p.Index,
+				Extension:  p.Extension,
+				Type:       p.Type,
+				Rating:     p.Rating,
+				Flag:       p.Flag,
+				CapturedAt: p.CapturedAt,
+				Size:       p.Size,
+				Hash:       p.Hash,
+				Metadata:   p.Metadata,
+			}
+			for _, t := range p.Tags {
+				mp.Tags = append(mp.Tags, t.Path)
+			}
+			msf.Pictures = append(msf.Pictures, mp)
+		}
+
+		m.SubFolders = append(m.SubFolders, msf)
+	}
+
+	return m, nil
+}
+
+// writeAlbumManifest stores the manifest of an album in its directory. The file is replaced
+// in one rename so a crash never leaves a half-written manifest behind.
+func writeAlbumManifest(repo *repository.HierarchyRepository, id uint) error {
+	m, err := buildManifest(repo, id)
+	if err != nil {
+		return err
+	}
+	if m.UUID == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(libraryRoot, m.UUID, manifestFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// readAlbumManifest loads the manifest stored in an album directory.
+func readAlbumManifest(dir string) (*AlbumManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var m AlbumManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.Version > manifestVersion {
+		return nil, fmt.Errorf("manifest version %d is newer than supported version %d", m.Version, manifestVersion)
+	}
+
+	return &m, nil
+}
+
+// refreshManifests rewrites the manifests of the given albums. Failures are only logged:
+// the catalog stays authoritative and the next change or a full refresh writes them again.
+func refreshManifests(repo *repository.HierarchyRepository, albumIDs ...uint) {
+	for _, id := range albumIDs {
+		if err := writeAlbumManifest(repo, id); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Warn("IO warning: failed to write album manifest", "id", id, "error", err)
+		}
+	}
+}
+
+// writeManifests refreshes the manifests of the albums in and below the given nodes,
+// so renaming or moving a folder updates the paths recorded by every album inside it.
+func (s *HierarchyService) writeManifests(ids ...uint) {
+	for _, id := range ids {
+		nodes, err := s.repo.FindSubtree(id)
+		if err != nil {
+			slog.Warn("Service warning: failed to load nodes for manifests", "id", id, "error", err)
+			continue
+		}
+
+		for _, n := range nodes {
+			if n.Type == model.TypeAlbum {
+				refreshManifests(s.repo, n.ID)
+			}
+		}
+	}
+}
+
+// WriteManifests rewrites the manifest of every album, e.g. for albums created before manifests existed.
+func (s *LibraryService) WriteManifests() (int, error) {
+	nodes, err := s.hierarchyRepo.FindAllNodes()
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for _, n := range nodes {
+		if n.Type != model.TypeAlbum || n.UUID == "" {
+			continue
+		}
+		if err := writeAlbumManifest(s.hierarchyRepo, n.ID); err != nil {
+			slog.Error("IO error: failed to write album manifest", "album", n.Name, "error", err)
+			return written, err
+		}
+		written++
+	}
+
+	slog.Info("Album manifests written", "albums", written)
+	return written, nil
+}
+
+// RebuildSkip names an album directory or file the rebuild left out and why.
+type RebuildSkip struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// RebuildReport summarises what a rebuild restored.
+type RebuildReport struct {
+	Folders    int           `json:"folders"`
+	Albums     int           `json:"albums"`
+	SubFolders int           `json:"sub_folders"`
+	Pictures   int           `json:"pictures"`
+	Skipped    []RebuildSkip `json:"skipped"`
+}
+
+// Rebuild restores the folders, albums, subfolders and pictures described by the manifests in the
+// library root. Albums already in the catalog are left alone, so a rebuild can also recover albums
+// that went missing from an otherwise intact database. Pictures whose file is gone are skipped.
+func (s *LibraryService) Rebuild() (report *RebuildReport, err error) {
+	report = &RebuildReport{Skipped: []RebuildSkip{}}
+
+	entries, err := os.ReadDir(libraryRoot)
+	if err != nil {
+		slog.Error("IO error: failed to read library root", "path", libraryRoot, "error", err)
+		return nil, err
+	}
+
+	job := startJob(s.broker, JobRebuild, len(entries), 0)
+	defer func() { job.finish(err) }()
+
+	folders := make(map[string]*uint)
+	tags := make(map[string]uint)
+
+	for _, e := range entries {
+		job.step(1)
+		if !e.IsDir() || e.Name() == trashDir {
+			continue
+		}
+
+		dir := filepath.Join(libraryRoot, e.Name())
+		m, err := readAlbumManifest(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			report.Skipped = append(report.Skipped, RebuildSkip{Path: dir, Reason: err.Error()})
+			continue
+		}
+
+		// The directory name is what the pictures' locations are built from, it wins over the manifest
+		if _, err := s.hierarchyRepo.FindByUUID(e.Name()); err == nil {
+			report.Skipped = append(report.Skipped, RebuildSkip{Path: dir, Reason: "album is already in the catalog"})
+			continue
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return report, err
+		}
+
+		if err := s.rebuildAlbum(e.Name(), m, folders, tags, report); err != nil {
+			slog.Error("Service error: failed to rebuild album", "path", dir, "error", err)
+			return report, fmt.Errorf("rebuilding %s: %w", dir, err)
+		}
+	}
+
+	slog.Info("Catalog rebuilt from manifests", "folders", report.Folders, "albums", report.Albums,
+		"pictures", report.Pictures, "skipped", len(report.Skipped))
+	return report, nil
+}
+
+// rebuildAlbum stores one album from its manifest. folders and tags cache the ids resolved so far.
+func (s *LibraryService) rebuildAlbum(dirName string, m *AlbumManifest, folders map[string]*uint, tags map[string]uint, report *RebuildReport) error {
+	parentID, err := s.ensureFolderPath(m.Path, folders, report)
+	if err != nil {
+		return err
+	}
+
+	position, err := s.hierarchyRepo.NextPosition(parentID)
+	if err != nil {
+		return err
+	}
+
+	albumRoot := filepath.Join(libraryRoot, dirName)
+	album := &model.Hierarchy{
+		ParentID:    parentID,
+		Type:        model.TypeAlbum,
+		Name:        m.Name,
+		UUID:        dirName,
+		Position:    position,
+		CreatedAt:   m.CreatedAt,
+		Description: m.Description,
+		EventStart:  m.EventStart,
+		EventEnd:    m.EventEnd,
+		Location:    m.Location,
+		Client:      m.Client,
+		Contact:     m.Contact,
+	}
+
+	for key, value := range m.Attributes {
+		album.Attributes = append(album.Attributes, model.AlbumAttribute{Key: key, Value: value})
+	}
+
+	// Tag paths per picture, in the order the pictures are stored
+	var pictureTags [][]string
+	for _, msf := range m.SubFolders {
+		sub := model.SubFolder{Name: msf.Name, Location: filepath.Join(albumRoot, msf.Name)}
+
+		for _, mp := range msf.Pictures {
+			location := filepath.Join(sub.Location, mp.FileName)
+			if _, err := os.Stat(location); err != nil {
+				report.Skipped = append(report.Skipped, RebuildSkip{Path: location, Reason: "file does not exist"})
+				continue
+			}
+
+			sub.Pictures = append(sub.Pictures, model.Picture{
+				FileName:   mp.FileName,
+				Index:      mp.Index,
+				Extension:  mp.Extension,
+				Type:       mp.Type,
+				Location:   location,
+				Rating:     mp.Rating,
+				Flag:       mp.Flag,
+				CapturedAt: mp.CapturedAt,
+				Size:       mp.Size,
+				Hash:       mp.Hash,
+				Metadata:   mp.Metadata,
+			})
+			pictureTags = append(pictureTags, mp.Tags)
+		}
+
+		album.SubFolders = append(album.SubFolders, sub)
+	}
+
+	if err := s.hierarchyRepo.Create(album); err != nil {
+		return err
+	}
+
+	report.Albums++
+	report.SubFolders += len(album.SubFolders)
+
+	n := 0
+	for _, sub := range album.SubFolders {
+		for _, p := range sub.Pictures {
+			report.Pictures++
+
+			if m.Cover == sub.Name+"/"+p.FileName {
+				coverID := p.ID
+				album.CoverPictureID = &coverID
+			}
+
+			for _, path := range pictureTags[n] {
+				tagID, err := s.ensureTag(path, tags)
+				if err != nil {
+					return err
+				}
+				if _, err := s.tagRepo.Assign([]uint{p.ID}, []uint{tagID}); err != nil {
+					return err
+				}
+			}
+			n++
+		}
+	}
+
+	if album.CoverPictureID != nil {
+		if err := s.hierarchyRepo.Update(album); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Album restored from manifest", "album", album.Name, "uuid", album.UUID)
+	publishNodeEvents(s.broker, s.hierarchyRepo, events.NodeCreated, album.ID)
+	return nil
+}
+
+// ensureFolderPath returns the folder at the end of a manifest path, creating the folders that are missing.
+func (s *LibraryService) ensureFolderPath(path []string, folders map[string]*uint, report *RebuildReport) (*uint, error) {
+	var parentID *uint
+
+	for i, name := range path {
+		key := strings.Join(path[:i+1], "\x00")
+		if id, ok := folders[key]; ok {
+			parentID = id
+			continue
+		}
+
+		children, err := s.hierarchyRepo.FindChildren(parentID)
+		if err != nil {
+			return nil, err
+		}
+
+		var found *model.Hierarchy
+		for _, c := range children {
+			if c.Type == model.TypeFolder && c.Name == name {
+				found = c
+				break
+			}
+		}
+
+		if found == nil {
+			position, err := s.hierarchyRepo.NextPosition(parentID)
+			if err != nil {
+				return nil, err
+			}
+
+			found = &model.Hierarchy{ParentID: parentID, Type: model.TypeFolder, Name: name, Position: position}
+			if err := s.hierarchyRepo.Create(found); err != nil {
+				return nil, err
+			}
+			report.Folders++
+			publishNodeEvents(s.broker, s.hierarchyRepo, events.NodeCreated, found.ID)
+		}
+
+		id := found.ID
+		folders[key] = &id
+		parentID = &id
+	}
+
+	return parentID, nil
+}
+
+// ensureTag resolves a tag path from a manifest, creating the tags that are missing.
+func (s *LibraryService) ensureTag(path string, tags map[string]uint) (uint, error) {
+	if id, ok := tags[path]; ok {
+		return id, nil
+	}
+
+	names, fe := splitTagPath("tags", path)
+	if fe != nil {
+		return 0, fmt.Errorf("invalid tag %q: %s", path, fe.Message)
+	}
+
+	tag, err := s.tagRepo.EnsurePath(names)
+	if err != nil {
+		return 0, err
+	}
+
+	tags[path] = tag.ID
+	return tag.ID, nil
+}
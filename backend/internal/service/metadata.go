@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"picturebot-backend/internal/model"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// readMetadata decodes the EXIF block of a JPEG or TIFF-based RAW file.
+// It returns the camera settings and the original capture time when present.
+func readMetadata(path string) (*model.PictureMetadata, *time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	x, err := exif.Decode(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode exif: %w", err)
+	}
+
+	meta := &model.PictureMetadata{
+		Camera: exifString(x, exif.Model),
+		Lens:   exifString(x, exif.LensModel),
+	}
+
+	if tag, err := x.Get(exif.ISOSpeedRatings); err == nil {
+		if v, err := tag.Int(0); err == nil {
+			meta.ISO = v
+		}
+	}
+
+	if v, ok := exifRational(x, exif.FNumber); ok {
+		meta.Aperture = v
+	}
+
+	if v, ok := exifRational(x, exif.FocalLength); ok {
+		meta.FocalLength = v
+	}
+
+	if tag, err := x.Get(exif.ExposureTime); err == nil && tag.Format() == tiff.RatVal {
+		if num, den, err := tag.Rat2(0); err == nil && num > 0 && den > 0 {
+			if num >= den {
+				meta.ShutterSpeed = fmt.Sprintf("%g", float64(num)/float64(den))
+			} else {
+				meta.ShutterSpeed = fmt.Sprintf("1/%d", den/num)
+			}
+		}
+	}
+
+	var capturedAt *time.Time
+	if t, err := x.DateTime(); err == nil {
+		capturedAt = &t
+	}
+
+	return meta, capturedAt, nil
+}
+
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+
+	v, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimRight(v, "\x00"))
+}
+
+func exifRational(x *exif.Exif, name exif.FieldName) (float64, bool) {
+	tag, err := x.Get(name)
+	if err != nil || tag.Format() != tiff.RatVal {
+		return 0, false
+	}
+
+	num, den, err := tag.Rat2(0)
+	if err != nil || den == 0 {
+		return 0, false
+	}
+
+	return float64(num) / float64(den), true
+}
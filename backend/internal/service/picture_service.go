@@ -1,17 +1,38 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"picturebot-backend/internal/events"
 	"picturebot-backend/internal/model"
 	"picturebot-backend/internal/repository"
+	"picturebot-backend/internal/search"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidQuery is returned for malformed listing options or search queries.
+	ErrInvalidQuery    = errors.New("invalid query")
+	ErrPictureNotFound = errors.New("picture not found")
 )
 
+// maxRating is the highest star rating a picture can have.
+const maxRating = 5
+
 type PictureService struct {
-	repo *repository.PictureRepository
+	repo          *repository.PictureRepository
+	hierarchyRepo *repository.HierarchyRepository
+	broker        *events.Broker
 }
 
-func NewPictureService(repo *repository.PictureRepository) *PictureService {
-	return &PictureService{repo: repo}
+func NewPictureService(repo *repository.PictureRepository, hierarchyRepo *repository.HierarchyRepository, broker *events.Broker) *PictureService {
+	return &PictureService{
+		repo:          repo,
+		hierarchyRepo: hierarchyRepo,
+		broker:        broker,
+	}
 }
 
 func (s *PictureService) CreatePicture(picture *model.Picture) error {
@@ -22,12 +43,16 @@ func (s *PictureService) CreatePicture(picture *model.Picture) error {
 	return err
 }
 
-func (s *PictureService) GetPictures() ([]model.Picture, error) {
-	pictures, err := s.repo.FindAll()
+func (s *PictureService) GetPictures(q repository.PictureQuery) ([]model.Picture, int64, error) {
+	if err := validatePictureQuery(q); err != nil {
+		return nil, 0, err
+	}
+
+	pictures, total, err := s.repo.FindAll(q)
 	if err != nil {
 		slog.Error("Service: Failed to fetch all pictures", "error", err)
 	}
-	return pictures, err
+	return pictures, total, err
 }
 
 func (s *PictureService) FindByID(id uint) (*model.Picture, error) {
@@ -39,12 +64,119 @@ func (s *PictureService) FindByID(id uint) (*model.Picture, error) {
 	return picture, err
 }
 
-func (s *PictureService) FindByHierarchyID(hierarchyID uint) ([]model.Picture, error) {
-	pictures, err := s.repo.FindByHierarchyID(hierarchyID)
+func (s *PictureService) FindByHierarchyID(hierarchyID uint, q repository.PictureQuery) ([]model.Picture, int64, error) {
+	if err := validatePictureQuery(q); err != nil {
+		return nil, 0, err
+	}
+
+	node, err := s.hierarchyRepo.FindByID(hierarchyID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		slog.Error("Service error: Failed to load hierarchy node", "hierarchyID", hierarchyID, "error", err)
+		return nil, 0, err
+	}
+
+	// Smart albums are evaluated on every read so they follow rating and metadata changes
+	if err == nil && node.Type == model.TypeSmart {
+		return s.Search(node.Query, q)
+	}
+
+	pictures, total, err := s.repo.FindByHierarchyID(hierarchyID, q)
 	if err != nil {
 		slog.Error("Service error: Failed to find pictures by hierarchy ID", "hierarchyID", hierarchyID, "error", err)
+	}
+
+	return pictures, total, err
+}
+
+// UpdatePictureRequest changes the review state of a picture. Fields left out keep their value.
+type UpdatePictureRequest struct {
+	Rating *int    `json:"rating"` // 0 to 5 stars
+	Flag   *string `json:"flag"`   // "pick", "reject" or "" to clear
+}
+
+// UpdatePicture rates or flags a picture and refreshes its album's manifest.
+func (s *PictureService) UpdatePicture(id uint, req UpdatePictureRequest) (*model.Picture, error) {
+	picture, err := s.repo.FindByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPictureNotFound
+		}
+		return nil, err
+	}
+
+	verr := &ValidationError{}
+	if req.Rating != nil {
+		if *req.Rating < 0 || *req.Rating > maxRating {
+			verr.add("rating", CodeInvalid, fmt.Sprintf("rating must be between 0 and %d", maxRating))
+		}
+		picture.Rating = *req.Rating
+	}
+	if req.Flag != nil {
+		switch *req.Flag {
+		case "", model.FlagPick, model.FlagReject:
+		default:
+			verr.add("flag", CodeInvalid, fmt.Sprintf("flag must be %q, %q or empty", model.FlagPick, model.FlagReject))
+		}
+		picture.Flag = *req.Flag
+	}
+	if err := verr.orNil(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SetReview(id, picture.Rating, picture.Flag); err != nil {
+		slog.Error("Service error: Failed to update picture", "id", id, "error", err)
+		return nil, err
+	}
+
+	slog.Info("Picture updated", "id", id, "rating", picture.Rating, "flag", picture.Flag)
+
+	albumIDs, err := s.repo.FindAlbumIDs([]uint{id})
+	if err != nil {
+		slog.Warn("Service warning: failed to find album of updated picture", "id", id, "error", err)
+	}
+	refreshManifests(s.hierarchyRepo, albumIDs...)
+	s.broker.Publish(events.PictureUpdated, picture)
+
+	return picture, nil
+}
+
+// Search parses a query in the search language and returns the matching pictures across the library.
+func (s *PictureService) Search(raw string, q repository.PictureQuery) ([]model.Picture, int64, error) {
+	if err := validatePictureQuery(q); err != nil {
+		return nil, 0, err
+	}
+
+	node, err := search.Parse(raw)
+	if err != nil {
+		slog.Info("Service: Rejected search query", "query", raw, "error", err)
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+
+	pictures, total, err := s.repo.Search(node, q)
+	if err != nil {
+		slog.Error("Service error: Failed to search pictures", "query", raw, "error", err)
+	}
+
+	return pictures, total, err
+}
+
+// validatePictureQuery rejects paging values and column names the repository does not know about.
+func validatePictureQuery(q repository.PictureQuery) error {
+	if q.Limit < 0 || q.Offset < 0 {
+		return fmt.Errorf("%w: limit and offset must not be negative", ErrInvalidQuery)
+	}
+
+	if q.Sort != "" {
+		if _, ok := repository.PictureSortColumns[q.Sort]; !ok {
+			return fmt.Errorf("%w: unknown sort key %q", ErrInvalidQuery, q.Sort)
+		}
+	}
 
+	for _, f := range q.Fields {
+		if !repository.PictureFieldColumns[f] {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, f)
+		}
 	}
 
-	return pictures, err
+	return nil
 }
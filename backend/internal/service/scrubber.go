@@ -0,0 +1,342 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"picturebot-backend/internal/events"
+	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/repository"
+	"sync"
+	"time"
+)
+
+const (
+	scrubBatchSize     = 100       // Pictures loaded per query during a pass
+	scrubPollInterval  = time.Hour // How often the scrubber looks for pictures that are due
+	defaultScrubRateMB = 20
+)
+
+var ErrScrubRunning = errors.New("a scrub pass is already running")
+
+// ScrubService re-reads picture files in the background and compares them with the hash recorded
+// at import, so silent corruption on the archive drive is noticed while backups still hold a good copy.
+type ScrubService struct {
+	pictureRepo  *repository.PictureRepository
+	settingsRepo *repository.SettingsRepository
+	broker       *events.Broker
+
+	trigger chan bool // Starts a pass right away, true re-verifies every picture
+
+	mu     sync.Mutex
+	status ScrubStatus
+}
+
+func NewScrubService(pictureRepo *repository.PictureRepository, settingsRepo *repository.SettingsRepository, broker *events.Broker) *ScrubService {
+	return &ScrubService{
+		pictureRepo:  pictureRepo,
+		settingsRepo: settingsRepo,
+		broker:       broker,
+		trigger:      make(chan bool, 1),
+	}
+}
+
+// ScrubStatus describes the running or the last finished scrub pass.
+type ScrubStatus struct {
+	Running    bool       `json:"running"`
+	All        bool       `json:"all"` // The pass re-verifies every picture, not only the due ones
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Verified   int        `json:"verified"`  // Files found intact
+	Corrupted  int        `json:"corrupted"` // Files that failed verification
+	Bytes      int64      `json:"bytes"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// ScrubReport combines the pass status with the verification state of the whole library.
+type ScrubReport struct {
+	Pass         ScrubStatus            `json:"pass"`
+	Library      repository.ScrubCounts `json:"library"`
+	IntervalDays int                    `json:"interval_days"`
+	RateMB       int                    `json:"rate_mb"`
+	Corrupted    []model.Picture        `json:"corrupted_pictures"`
+}
+
+// Run scrubs the pictures that are due, then waits for the next poll or a manual start.
+// It returns when ctx is cancelled, an interrupted pass continues with the same files next time.
+func (s *ScrubService) Run(ctx context.Context) {
+	ticker := time.NewTicker(scrubPollInterval)
+	defer ticker.Stop()
+
+	manual, all := false, false
+	for {
+		s.pass(ctx, manual, all)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			manual, all = false, false
+		case all = <-s.trigger:
+			manual = true
+		}
+	}
+}
+
+// Start asks the running scrubber for a pass now. It verifies the pictures that are due, which are only
+// the never verified ones while scheduled scrubbing is off. With all set every picture is verified again.
+func (s *ScrubService) Start(all bool) error {
+	s.mu.Lock()
+	running := s.status.Running
+	s.mu.Unlock()
+
+	if running {
+		return ErrScrubRunning
+	}
+
+	select {
+	case s.trigger <- all:
+		return nil
+	default:
+		return ErrScrubRunning
+	}
+}
+
+// Report returns the status of the scrubber and every picture that failed its last verification.
+func (s *ScrubService) Report() (*ScrubReport, error) {
+	settings, err := s.settingsRepo.GetSettings()
+	if err != nil {
+		slog.Error("Service error: failed to load settings", "error", err)
+		return nil, err
+	}
+
+	var before *time.Time
+	if settings.ScrubIntervalDays > 0 {
+		t := time.Now().AddDate(0, 0, -settings.ScrubIntervalDays)
+		before = &t
+	}
+
+	counts, err := s.pictureRepo.CountScrub(before)
+	if err != nil {
+		slog.Error("Service error: failed to count scrub state", "error", err)
+		return nil, err
+	}
+
+	corrupted, err := s.pictureRepo.FindCorrupted()
+	if err != nil {
+		slog.Error("Service error: failed to load corrupted pictures", "error", err)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	status := s.status
+	s.mu.Unlock()
+
+	return &ScrubReport{
+		Pass:         status,
+		Library:      counts,
+		IntervalDays: settings.ScrubIntervalDays,
+		RateMB:       scrubRate(settings),
+		Corrupted:    corrupted,
+	}, nil
+}
+
+// pass verifies every picture that is due, or every picture at all when all is set.
+// Scheduled passes only run while a scrub interval is configured.
+func (s *ScrubService) pass(ctx context.Context, manual, all bool) {
+	settings, err := s.settingsRepo.GetSettings()
+	if err != nil {
+		slog.Error("Service error: failed to load settings for scrubbing", "error", err)
+		return
+	}
+
+	if !manual && settings.ScrubIntervalDays <= 0 {
+		return
+	}
+
+	start := time.Now()
+	var before time.Time // Only never verified pictures are older than the zero time
+	switch {
+	case all:
+		before = start
+	case settings.ScrubIntervalDays > 0:
+		before = start.AddDate(0, 0, -settings.ScrubIntervalDays)
+	}
+
+	// Polls that find nothing to do keep the status of the last real pass
+	due, err := s.pictureRepo.FindDueForScrub(before, 1)
+	if err != nil {
+		slog.Error("Service error: failed to find pictures to scrub", "error", err)
+		return
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	var total int64
+	if counts, err := s.pictureRepo.CountScrub(&before); err == nil {
+		total = counts.Due
+	}
+
+	s.mu.Lock()
+	s.status = ScrubStatus{Running: true, All: all, StartedAt: &start}
+	s.mu.Unlock()
+
+	job := startJob(s.broker, JobScrub, int(total), 0)
+	limiter := &rateLimiter{bytesPerSecond: float64(scrubRate(settings)) * 1024 * 1024, start: start}
+	err = s.scrubDue(ctx, before, limiter, job)
+	job.finish(err)
+
+	finished := time.Now()
+	s.mu.Lock()
+	s.status.Running = false
+	s.status.FinishedAt = &finished
+	if err != nil && !errors.Is(err, context.Canceled) {
+		s.status.Error = err.Error()
+	}
+	status := s.status
+	s.mu.Unlock()
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		slog.Error("Service error: scrub pass failed", "error", err)
+	}
+
+	slog.Info("Scrub pass complete", "verified", status.Verified, "corrupted", status.Corrupted,
+		"bytes", status.Bytes, "duration", finished.Sub(start).Round(time.Second).String())
+}
+
+func (s *ScrubService) scrubDue(ctx context.Context, before time.Time, limiter *rateLimiter, job *Job) error {
+	for {
+		pictures, err := s.pictureRepo.FindDueForScrub(before, scrubBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(pictures) == 0 {
+			return nil
+		}
+
+		for _, p := range pictures {
+			if err := s.scrubPicture(ctx, p, limiter); err != nil {
+				return err
+			}
+			job.step(1)
+		}
+	}
+}
+
+// scrubPicture verifies one file and records the outcome. Only database and context errors are returned,
+// problems with the file itself are stored on the picture.
+func (s *ScrubService) scrubPicture(ctx context.Context, p model.Picture, limiter *rateLimiter) error {
+	hash, n, err := hashFileThrottled(ctx, p.Location, limiter)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	now := time.Now()
+	detail := ""
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		detail = "file is missing"
+	case err != nil:
+		detail = "file cannot be read: " + err.Error()
+	case p.Hash != "" && hash != p.Hash:
+		detail = "file content does not match the hash recorded at import"
+	}
+
+	s.mu.Lock()
+	s.status.Bytes += n
+	if detail == "" {
+		s.status.Verified++
+	} else {
+		s.status.Corrupted++
+	}
+	s.mu.Unlock()
+
+	if detail != "" {
+		slog.Error("Integrity error: picture failed verification", "id", p.ID, "path", p.Location, "problem", detail)
+		return s.pictureRepo.MarkCorrupted(p.ID, detail, now)
+	}
+
+	if p.CorruptedAt != nil {
+		slog.Info("Picture verified again after earlier corruption", "id", p.ID, "path", p.Location)
+	}
+
+	// Pictures imported before hashes were recorded get their first hash as the reference
+	baseline := ""
+	if p.Hash == "" {
+		baseline = hash
+	}
+
+	return s.pictureRepo.MarkVerified(p.ID, baseline, now)
+}
+
+func scrubRate(settings *model.Settings) int {
+	if settings.ScrubRateMB <= 0 {
+		return defaultScrubRateMB
+	}
+	return settings.ScrubRateMB
+}
+
+// hashFileThrottled returns the SHA-256 of a file like hashFile, reading no faster than the limiter allows.
+func hashFileThrottled(ctx context.Context, path string, limiter *rateLimiter) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, &throttledReader{ctx: ctx, r: f, limiter: limiter})
+	if err != nil {
+		return "", n, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// rateLimiter spreads reads over time so the average rate since start stays below bytesPerSecond.
+type rateLimiter struct {
+	bytesPerSecond float64
+	start          time.Time
+	read           int64
+}
+
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.read += int64(n)
+	due := l.start.Add(time.Duration(float64(l.read) / l.bytesPerSecond * float64(time.Second)))
+
+	d := time.Until(due)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.limiter.wait(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
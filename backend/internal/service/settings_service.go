@@ -1,17 +1,29 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"path/filepath"
 	"picturebot-backend/internal/model"
 	"picturebot-backend/internal/repository"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
 )
 
 type SettingsService struct {
-	repo *repository.SettingsRepository
+	repo          *repository.SettingsRepository
+	hierarchyRepo *repository.HierarchyRepository
 }
 
-func NewSettingsService(repo *repository.SettingsRepository) *SettingsService {
-	return &SettingsService{repo: repo}
+func NewSettingsService(repo *repository.SettingsRepository, hierarchyRepo *repository.HierarchyRepository) *SettingsService {
+	return &SettingsService{
+		repo:          repo,
+		hierarchyRepo: hierarchyRepo,
+	}
 }
 
 func (s *SettingsService) GetSettings() (*model.Settings, error) {
@@ -23,15 +35,237 @@ func (s *SettingsService) GetSettings() (*model.Settings, error) {
 	return settings, err
 }
 
-func (s *SettingsService) UpdateSettings(settings *model.Settings) error {
-	err := s.repo.UpdateSettings(settings)
+// UpdateSettingsRequest changes the settings that are set and leaves the others as stored.
+type UpdateSettingsRequest struct {
+	ThemeMode           *string                    `json:"theme_mode"`
+	LibraryPath         *string                    `json:"library_path"`
+	RootSortMode        *model.SortMode            `json:"root_sort_mode"`
+	SubFolderTemplates  *[]model.SubFolderTemplate `json:"sub_folder_templates"`
+	DefaultTemplate     *string                    `json:"default_template"`
+	ScrubIntervalDays   *int                       `json:"scrub_interval_days"`
+	ScrubRateMB         *int                       `json:"scrub_rate_mb"`
+	WatchAlbums         *bool                      `json:"watch_albums"`
+	HotFolders          *[]model.HotFolder         `json:"hot_folders"`
+	BackupDir           *string                    `json:"backup_dir"`
+	BackupIntervalHours *int                       `json:"backup_interval_hours"`
+	BackupKeep          *int                       `json:"backup_keep"`
+}
+
+// apply copies the fields that are set onto settings.
+func (req UpdateSettingsRequest) apply(settings *model.Settings) {
+	if req.ThemeMode != nil {
+		settings.ThemeMode = *req.ThemeMode
+	}
+	if req.LibraryPath != nil {
+		settings.LibraryPath = *req.LibraryPath
+	}
+	if req.RootSortMode != nil {
+		settings.RootSortMode = *req.RootSortMode
+	}
+	if req.SubFolderTemplates != nil {
+		settings.SubFolderTemplates = *req.SubFolderTemplates
+	}
+	if req.DefaultTemplate != nil {
+		settings.DefaultTemplate = *req.DefaultTemplate
+	}
+	if req.ScrubIntervalDays != nil {
+		settings.ScrubIntervalDays = *req.ScrubIntervalDays
+	}
+	if req.ScrubRateMB != nil {
+		settings.ScrubRateMB = *req.ScrubRateMB
+	}
+	if req.WatchAlbums != nil {
+		settings.WatchAlbums = *req.WatchAlbums
+	}
+	if req.HotFolders != nil {
+		settings.HotFolders = *req.HotFolders
+	}
+	if req.BackupDir != nil {
+		settings.BackupDir = *req.BackupDir
+	}
+	if req.BackupIntervalHours != nil {
+		settings.BackupIntervalHours = *req.BackupIntervalHours
+	}
+	if req.BackupKeep != nil {
+		settings.BackupKeep = *req.BackupKeep
+	}
+}
+
+// UpdateSettings applies the request to the stored settings and returns the result.
+func (s *SettingsService) UpdateSettings(req UpdateSettingsRequest) (*model.Settings, error) {
+	settings, err := s.repo.GetSettings()
+	if err != nil {
+		slog.Error("Service error: Failed to load settings for update", "error", err)
+		return nil, err
+	}
+
+	req.apply(settings)
+
+	if err := s.validateSettings(settings); err != nil {
+		slog.Info("Service: Rejected settings update", "error", err)
+		return nil, err
+	}
+
+	err = s.repo.UpdateSettings(settings)
 	if err != nil {
 		slog.Error("Service error: Failed to update settings", "error", err)
 
-		return err
+		return nil, err
 	}
 
 	slog.Info("System settings updated", "id", settings.ID)
 	
+	return settings, nil
+}
+
+// validateSettings normalises the settings in place and checks every field that has rules.
+func (s *SettingsService) validateSettings(settings *model.Settings) error {
+	verr := &ValidationError{}
+
+	verr.addField(validateSortMode("root_sort_mode", settings.RootSortMode))
+	validateTemplates(settings, verr)
+	if err := s.validateHotFolders(settings, verr); err != nil {
+		return err
+	}
+
+	if settings.ScrubIntervalDays < 0 {
+		verr.add("scrub_interval_days", CodeInvalid, "scrub interval must not be negative, use 0 to turn scrubbing off")
+	}
+	if settings.ScrubRateMB < 0 {
+		verr.add("scrub_rate_mb", CodeInvalid, "scrub rate must not be negative, use 0 for the default rate")
+	}
+
+	settings.BackupDir = strings.TrimSpace(settings.BackupDir)
+	if settings.BackupDir != "" && !filepath.IsAbs(settings.BackupDir) {
+		verr.add("backup_dir", CodeInvalid, "backup directory must be absolute")
+	}
+	if settings.BackupIntervalHours < 0 {
+		verr.add("backup_interval_hours", CodeInvalid, "backup interval must not be negative, use 0 to turn scheduled backups off")
+	}
+	if settings.BackupKeep < 0 {
+		verr.add("backup_keep", CodeInvalid, "number of backups to keep must not be negative, use 0 to keep all")
+	}
+
+	return verr.orNil()
+}
+
+// validateHotFolders normalises the hot folders in place and checks their inbox, destination and album naming.
+func (s *SettingsService) validateHotFolders(settings *model.Settings, verr *ValidationError) error {
+	paths := make(map[string]bool)
+
+	for i := range settings.HotFolders {
+		hf := &settings.HotFolders[i]
+		field := fmt.Sprintf("hot_folders[%d]", i)
+
+		hf.Path = strings.TrimSpace(hf.Path)
+		key := strings.ToLower(filepath.Clean(hf.Path))
+		switch {
+		case hf.Path == "":
+			verr.add(field+".path", CodeRequired, "inbox path must not be empty")
+		case !filepath.IsAbs(hf.Path):
+			verr.add(field+".path", CodeInvalid, "inbox path must be absolute")
+		case insideDir(hf.Path, libraryRoot):
+			verr.add(field+".path", CodeNotAllowed, "inbox must not be inside the library")
+		case paths[key]:
+			verr.add(field+".path", CodeDuplicate, fmt.Sprintf("inbox %s is listed twice", hf.Path))
+		}
+		paths[key] = true
+
+		hf.NameRule = strings.TrimSpace(hf.NameRule)
+		if hf.NameRule == "" {
+			hf.NameRule = defaultNameRule
+		}
+		if fe := validateNodeName(expandNameRule(hf.NameRule, time.Now())); fe != nil {
+			verr.add(field+".name_rule", fe.Code, "album names from this rule are invalid: "+fe.Message)
+		}
+
+		switch hf.Mode {
+		case "":
+			hf.Mode = model.HotFolderRolling
+		case model.HotFolderRolling, model.HotFolderSession:
+		default:
+			verr.add(field+".mode", CodeInvalid, fmt.Sprintf("mode must be %q or %q", model.HotFolderRolling, model.HotFolderSession))
+		}
+
+		if hf.GapMinutes < 0 {
+			verr.add(field+".gap_minutes", CodeInvalid, "gap must not be negative, use 0 for the default")
+		}
+		if hf.SettleSeconds < 0 {
+			verr.add(field+".settle_seconds", CodeInvalid, "settle time must not be negative, use 0 for the default")
+		}
+
+		// Imports sort files into RAWs and JPGs; an unknown default template is reported by validateTemplates
+		hf.Template = strings.TrimSpace(hf.Template)
+		if hf.Template != "" && findTemplate(settings, hf.Template) == nil {
+			verr.add(field+".template", CodeNotFound, fmt.Sprintf("no template named %q", hf.Template))
+		} else if folders, fe := resolveSubFolders(settings, CreateNodeRequest{Template: hf.Template}); fe == nil && (!containsFold(folders, rawFolder) || !containsFold(folders, jpgFolder)) {
+			verr.add(field+".template", CodeInvalid, fmt.Sprintf("importing needs the %s and %s subfolders", rawFolder, jpgFolder))
+		}
+
+		if hf.FolderID != 0 {
+			folder, err := s.hierarchyRepo.FindByID(hf.FolderID)
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				verr.add(field+".folder_id", CodeNotFound, fmt.Sprintf("folder %d does not exist", hf.FolderID))
+			case err != nil:
+				return err
+			case folder.Type != model.TypeFolder:
+				verr.add(field+".folder_id", CodeNotFolder, fmt.Sprintf("node %d is not a folder", hf.FolderID))
+			}
+		}
+	}
+
 	return nil
 }
+
+// insideDir reports whether path is dir or lies below it.
+func insideDir(path, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// validateTemplates trims the subfolder templates in place and checks their names, folders and the default.
+func validateTemplates(settings *model.Settings, verr *ValidationError) {
+	names := make(map[string]bool)
+
+	for i := range settings.SubFolderTemplates {
+		tpl := &settings.SubFolderTemplates[i]
+		field := fmt.Sprintf("sub_folder_templates[%d]", i)
+
+		tpl.Name = strings.TrimSpace(tpl.Name)
+		switch {
+		case tpl.Name == "":
+			verr.add(field+".name", CodeRequired, "template name must not be empty")
+		case utf8.RuneCountInString(tpl.Name) > maxAttributeKeyLength:
+			verr.add(field+".name", CodeTooLong, fmt.Sprintf("template name must be at most %d characters", maxAttributeKeyLength))
+		case names[strings.ToLower(tpl.Name)]:
+			verr.add(field+".name", CodeDuplicate, fmt.Sprintf("another template named %q already exists", tpl.Name))
+		}
+		names[strings.ToLower(tpl.Name)] = true
+
+		if len(tpl.Folders) == 0 {
+			verr.add(field+".folders", CodeRequired, "a template needs at least one subfolder")
+		}
+
+		folders := make(map[string]bool)
+		for j, folder := range tpl.Folders {
+			folder = strings.TrimSpace(folder)
+			tpl.Folders[j] = folder
+
+			folderField := fmt.Sprintf("%s.folders[%d]", field, j)
+			if fe := validateSubFolderName(folderField, folder); fe != nil {
+				verr.addField(fe)
+				continue
+			}
+			if folders[strings.ToLower(folder)] {
+				verr.add(folderField, CodeDuplicate, fmt.Sprintf("subfolder %q is listed twice", folder))
+			}
+			folders[strings.ToLower(folder)] = true
+		}
+	}
+
+	settings.DefaultTemplate = strings.TrimSpace(settings.DefaultTemplate)
+	if settings.DefaultTemplate != "" && !names[strings.ToLower(settings.DefaultTemplate)] {
+		verr.add("default_template", CodeNotFound, fmt.Sprintf("no template named %q", settings.DefaultTemplate))
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/repository"
+	"picturebot-backend/internal/search"
+
+	"gorm.io/gorm"
+)
+
+// GetNodeStats returns the aggregate stats of one node. Folders roll up every album below them
+// and smart albums aggregate the pictures their query currently matches.
+func (s *HierarchyService) GetNodeStats(id uint) (*repository.NodeStats, error) {
+	node, err := s.repo.FindByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNodeNotFound
+		}
+		return nil, err
+	}
+
+	if node.Type == model.TypeSmart {
+		return s.smartStats(node)
+	}
+
+	total, err := s.pictureRepo.SubtreeStats(id)
+	if err != nil {
+		slog.Error("Service error: failed to aggregate picture stats", "id", id, "error", err)
+		return nil, err
+	}
+
+	return total, nil
+}
+
+// GetAllStats returns the stats of every node keyed by id, rolled up through the folder tree.
+// Smart albums are left out of folder totals so their pictures are not counted twice.
+func (s *HierarchyService) GetAllStats() (map[uint]*repository.NodeStats, error) {
+	allNodes, err := s.repo.FindAllNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	byAlbum, err := s.pictureRepo.StatsByAlbum()
+	if err != nil {
+		slog.Error("Service error: failed to aggregate picture stats", "error", err)
+		return nil, err
+	}
+
+	result := make(map[uint]*repository.NodeStats, len(allNodes))
+
+	var rollUp func(node *model.Hierarchy) *repository.NodeStats
+	rollUp = func(node *model.Hierarchy) *repository.NodeStats {
+		total := repository.NewNodeStats()
+		if albumStats, ok := byAlbum[node.ID]; ok {
+			total.Add(albumStats)
+		}
+
+		for _, child := range node.Children {
+			childStats := rollUp(child)
+			if child.Type != model.TypeSmart {
+				total.Add(childStats)
+			}
+		}
+
+		if node.Type == model.TypeSmart {
+			smart, err := s.smartStats(node)
+			if err != nil {
+				slog.Warn("Service: Skipping stats of smart album", "id", node.ID, "error", err)
+			} else {
+				total = smart
+			}
+		}
+
+		result[node.ID] = total
+		return total
+	}
+
+	for _, root := range buildTree(allNodes) {
+		rollUp(root)
+	}
+
+	return result, nil
+}
+
+func (s *HierarchyService) smartStats(node *model.Hierarchy) (*repository.NodeStats, error) {
+	parsed, err := search.Parse(node.Query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+
+	return s.pictureRepo.SearchStats(parsed)
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"picturebot-backend/internal/events"
+	"picturebot-backend/internal/model"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// The subfolders imports sort files into.
+const (
+	rawFolder = "RAWs"
+	jpgFolder = "JPGs"
+)
+
+// ErrSubFolderNotFound is returned when a subfolder does not exist or belongs to another album.
+var ErrSubFolderNotFound = errors.New("subfolder not found")
+
+// defaultSubFolders is the layout used when the settings define no templates.
+var defaultSubFolders = []string{rawFolder, jpgFolder}
+
+// resolveSubFolders returns the subfolder names of a new album: the requested or default template
+// followed by any extra subfolders from the request that the template does not already have.
+func resolveSubFolders(settings *model.Settings, req CreateNodeRequest) ([]string, *FieldError) {
+	name := req.Template
+	if name == "" {
+		name = settings.DefaultTemplate
+	}
+
+	folders := defaultSubFolders
+	if name != "" {
+		tpl := findTemplate(settings, name)
+		if tpl == nil {
+			return nil, &FieldError{Field: "template", Code: CodeNotFound, Message: fmt.Sprintf("no subfolder template named %q", name)}
+		}
+		folders = tpl.Folders
+	}
+
+	names := append([]string{}, folders...)
+	for _, sub := range req.SubFolders {
+		extra := strings.TrimSpace(sub.Name)
+		if extra != "" && !containsFold(names, extra) {
+			names = append(names, extra)
+		}
+	}
+
+	return names, nil
+}
+
+func findTemplate(settings *model.Settings, name string) *model.SubFolderTemplate {
+	for i := range settings.SubFolderTemplates {
+		if strings.EqualFold(settings.SubFolderTemplates[i].Name, name) {
+			return &settings.SubFolderTemplates[i]
+		}
+	}
+	return nil
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddSubFolder creates a new subfolder and its directory in an existing album.
+func (s *HierarchyService) AddSubFolder(albumID uint, name string) (*model.SubFolder, error) {
+	album, err := s.loadAlbum(albumID)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if err := s.validateSubFolderChange(album, 0, name); err != nil {
+		return nil, err
+	}
+
+	sub, err := s.addSubFolder(album, name)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Subfolder added", "album", album.Name, "name", name)
+	s.writeManifests(album.ID)
+	s.publishNodes(events.NodeUpdated, album.ID)
+	return sub, nil
+}
+
+// RenameSubFolder renames a subfolder's directory and moves the locations of its pictures along.
+// The directory is renamed back when the catalog cannot be updated.
+func (s *HierarchyService) RenameSubFolder(albumID, subFolderID uint, name string) (*model.SubFolder, error) {
+	album, sub, err := s.loadSubFolder(albumID, subFolderID)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if err := s.validateSubFolderChange(album, sub.ID, name); err != nil {
+		return nil, err
+	}
+
+	oldLocation := sub.Location
+	newLocation := filepath.Join(libraryRoot, album.UUID, name)
+
+	if err := renameDir(oldLocation, newLocation); err != nil {
+		slog.Error("IO error: failed to rename subfolder", "from", oldLocation, "to", newLocation, "error", err)
+		return nil, fmt.Errorf("failed to rename subfolder %s: %w", sub.Name, err)
+	}
+
+	sub.Name = name
+	sub.Location = newLocation
+	if err := s.subFolderRepo.Rename(sub); err != nil {
+		slog.Error("Service error: failed to store renamed subfolder, restoring directory", "id", sub.ID, "error", err)
+		if undoErr := renameDir(newLocation, oldLocation); undoErr != nil {
+			slog.Error("IO error: failed to restore subfolder directory", "path", oldLocation, "error", undoErr)
+		}
+		return nil, err
+	}
+
+	slog.Info("Subfolder renamed", "album", album.Name, "name", name)
+	s.writeManifests(album.ID)
+	s.publishNodes(events.NodeUpdated, album.ID)
+	return sub, nil
+}
+
+// RemoveSubFolder deletes an empty subfolder. Its directory is removed, or moved to the
+// library trash when it still holds files the catalog does not know about.
+func (s *HierarchyService) RemoveSubFolder(albumID, subFolderID uint) error {
+	album, sub, err := s.loadSubFolder(albumID, subFolderID)
+	if err != nil {
+		return err
+	}
+
+	count, err := s.subFolderRepo.CountPictures(sub.ID)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return &ValidationError{Fields: []FieldError{{
+			Field:   "id",
+			Code:    CodeNotAllowed,
+			Message: fmt.Sprintf("subfolder %s still holds %d pictures, move them first", sub.Name, count),
+		}}}
+	}
+
+	if err := s.subFolderRepo.Delete(sub); err != nil {
+		slog.Error("Service error: failed to delete subfolder", "id", sub.ID, "error", err)
+		return err
+	}
+
+	if err := removeDir(sub.Location); err != nil {
+		slog.Error("IO error: failed to remove subfolder directory", "path", sub.Location, "error", err)
+		return fmt.Errorf("subfolder deleted but removing %s failed: %w", sub.Location, err)
+	}
+
+	slog.Info("Subfolder removed", "album", album.Name, "name", sub.Name)
+	s.writeManifests(album.ID)
+	s.publishNodes(events.NodeUpdated, album.ID)
+	return nil
+}
+
+// loadSubFolder loads an album and one of its subfolders.
+func (s *HierarchyService) loadSubFolder(albumID, subFolderID uint) (*model.Hierarchy, *model.SubFolder, error) {
+	album, err := s.loadAlbum(albumID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sub, err := s.subFolderRepo.FindByID(subFolderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrSubFolderNotFound
+		}
+		return nil, nil, err
+	}
+
+	if sub.HierarchyID != album.ID {
+		return nil, nil, ErrSubFolderNotFound
+	}
+
+	return album, sub, nil
+}
+
+// validateSubFolderChange checks a new subfolder name against the name rules and the album's other subfolders.
+func (s *HierarchyService) validateSubFolderChange(album *model.Hierarchy, subFolderID uint, name string) error {
+	if fe := validateSubFolderName("name", name); fe != nil {
+		return &ValidationError{Fields: []FieldError{*fe}}
+	}
+
+	subs, err := s.subFolderRepo.FindByHierarchyID(album.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		if sub.ID != subFolderID && strings.EqualFold(sub.Name, name) {
+			return &ValidationError{Fields: []FieldError{{
+				Field:   "name",
+				Code:    CodeDuplicate,
+				Message: fmt.Sprintf("album already has a subfolder named %q", sub.Name),
+			}}}
+		}
+	}
+
+	return nil
+}
+
+// renameDir renames a directory, creating the target when the source was never created on disk.
+func renameDir(from, to string) error {
+	if _, err := os.Stat(from); errors.Is(err, os.ErrNotExist) {
+		return os.MkdirAll(to, 0755)
+	}
+
+	// Renaming only the case of a name needs no existence check on case-insensitive filesystems
+	if !strings.EqualFold(from, to) {
+		if _, err := os.Stat(to); err == nil {
+			return fmt.Errorf("%s already exists", to)
+		}
+	}
+
+	return os.Rename(from, to)
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"picturebot-backend/internal/events"
+	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/repository"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+var ErrTagNotFound = errors.New("tag not found")
+
+// maxTagNameLength matches the size of the tags.name column.
+const maxTagNameLength = 100
+
+// defaultSuggestLimit caps autocomplete results when the client does not ask for a limit.
+const defaultSuggestLimit = 10
+
+type TagService struct {
+	repo          *repository.TagRepository
+	pictureRepo   *repository.PictureRepository
+	hierarchyRepo *repository.HierarchyRepository
+	broker        *events.Broker
+}
+
+func NewTagService(repo *repository.TagRepository, pictureRepo *repository.PictureRepository, hierarchyRepo *repository.HierarchyRepository, broker *events.Broker) *TagService {
+	return &TagService{
+		repo:          repo,
+		pictureRepo:   pictureRepo,
+		hierarchyRepo: hierarchyRepo,
+		broker:        broker,
+	}
+}
+
+// TagRequest selects pictures and the tags to add to or remove from them.
+type TagRequest struct {
+	PictureIDs []uint   `json:"picture_ids"`
+	TagIDs     []uint   `json:"tag_ids"`
+	Paths      []string `json:"paths"` // Only used when tagging, missing tags are created
+	Shots      bool     `json:"shots"` // Also apply to the other files of each picture's shot
+}
+
+// TagResult reports how many assignments a bulk request changed.
+type TagResult struct {
+	Pictures int   `json:"pictures"`
+	Tags     int   `json:"tags"`
+	Changed  int64 `json:"changed"`
+}
+
+// GetTree returns the keyword tree with the picture counts of every tag.
+func (s *TagService) GetTree() ([]*model.Tag, error) {
+	tags, err := s.repo.FindAll()
+	if err != nil {
+		slog.Error("Service: Failed to retrieve tags", "error", err)
+		return nil, err
+	}
+
+	counts, err := s.repo.CountPictures()
+	if err != nil {
+		slog.Error("Service: Failed to count tagged pictures", "error", err)
+		return nil, err
+	}
+
+	byID := make(map[uint]*model.Tag, len(tags))
+	for _, tag := range tags {
+		tag.PictureCount = counts[tag.ID].Direct
+		tag.TotalCount = counts[tag.ID].Total
+		byID[tag.ID] = tag
+	}
+
+	// Tags are ordered by path, so every parent is known before its children
+	roots := []*model.Tag{}
+	for _, tag := range tags {
+		if tag.ParentID != nil {
+			if parent, ok := byID[*tag.ParentID]; ok {
+				parent.Children = append(parent.Children, tag)
+				continue
+			}
+		}
+		roots = append(roots, tag)
+	}
+
+	return roots, nil
+}
+
+// CreateTag creates the tag named by a path such as "Places/Belgium/Ghent" together with any missing parents.
+func (s *TagService) CreateTag(path string) (*model.Tag, error) {
+	names, fe := splitTagPath("path", path)
+	if fe != nil {
+		return nil, &ValidationError{Fields: []FieldError{*fe}}
+	}
+
+	tag, err := s.repo.EnsurePath(names)
+	if err != nil {
+		slog.Error("Service error: Failed to create tag", "path", path, "error", err)
+		return nil, err
+	}
+
+	slog.Info("Tag created", "id", tag.ID, "path", tag.Path)
+	s.broker.Publish(events.TagCreated, tag)
+	return tag, nil
+}
+
+// DeleteTag removes a tag together with the tags below it and their assignments.
+func (s *TagService) DeleteTag(id uint) (int64, error) {
+	tag, err := s.repo.FindByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrTagNotFound
+		}
+		return 0, err
+	}
+
+	albumIDs, err := s.repo.FindAlbumIDs(tag)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := s.repo.DeleteBranch(tag)
+	if err != nil {
+		slog.Error("Service error: Failed to delete tag", "id", id, "error", err)
+		return 0, err
+	}
+
+	slog.Info("Tag deleted", "path", tag.Path, "tags", deleted)
+	refreshManifests(s.hierarchyRepo, albumIDs...)
+	s.broker.Publish(events.TagDeleted, tag)
+	return deleted, nil
+}
+
+// Suggest returns tags for autocomplete, matching the start of a name or any part of a path.
+func (s *TagService) Suggest(prefix string, limit int) ([]*model.Tag, error) {
+	if limit <= 0 {
+		limit = defaultSuggestLimit
+	}
+
+	tags, err := s.repo.Suggest(strings.TrimSpace(prefix), limit)
+	if err != nil {
+		slog.Error("Service error: Failed to suggest tags", "prefix", prefix, "error", err)
+	}
+
+	return tags, err
+}
+
+// TagPictures adds tags to pictures in bulk.
+func (s *TagService) TagPictures(req TagRequest) (*TagResult, error) {
+	verr := &ValidationError{}
+
+	tagIDs := append([]uint{}, req.TagIDs...)
+	var paths [][]string
+	for _, p := range req.Paths {
+		names, fe := splitTagPath("paths", p)
+		verr.addField(fe)
+		paths = append(paths, names)
+	}
+
+	if len(req.TagIDs) == 0 && len(req.Paths) == 0 {
+		verr.add("tag_ids", CodeRequired, "give at least one tag id or path")
+	}
+
+	pictureIDs, err := s.resolveTagRequest(req, verr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verr.orNil(); err != nil {
+		return nil, err
+	}
+
+	for _, names := range paths {
+		tag, err := s.repo.EnsurePath(names)
+		if err != nil {
+			slog.Error("Service error: Failed to create tag", "path", strings.Join(names, model.TagSeparator), "error", err)
+			return nil, err
+		}
+		tagIDs = append(tagIDs, tag.ID)
+	}
+
+	changed, err := s.repo.Assign(pictureIDs, tagIDs)
+	if err != nil {
+		slog.Error("Service error: Failed to tag pictures", "error", err)
+		return nil, err
+	}
+
+	slog.Info("Pictures tagged", "pictures", len(pictureIDs), "tags", len(tagIDs), "added", changed)
+	s.picturesChanged(pictureIDs)
+	return &TagResult{Pictures: len(pictureIDs), Tags: len(tagIDs), Changed: changed}, nil
+}
+
+// UntagPictures removes tags from pictures in bulk.
+func (s *TagService) UntagPictures(req TagRequest) (*TagResult, error) {
+	verr := &ValidationError{}
+
+	if len(req.TagIDs) == 0 {
+		verr.add("tag_ids", CodeRequired, "give at least one tag id")
+	}
+	if len(req.Paths) > 0 {
+		verr.add("paths", CodeNotAllowed, "untag by tag id")
+	}
+
+	pictureIDs, err := s.resolveTagRequest(req, verr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verr.orNil(); err != nil {
+		return nil, err
+	}
+
+	changed, err := s.repo.Unassign(pictureIDs, req.TagIDs)
+	if err != nil {
+		slog.Error("Service error: Failed to untag pictures", "error", err)
+		return nil, err
+	}
+
+	slog.Info("Pictures untagged", "pictures", len(pictureIDs), "tags", len(req.TagIDs), "removed", changed)
+	s.picturesChanged(pictureIDs)
+	return &TagResult{Pictures: len(pictureIDs), Tags: len(req.TagIDs), Changed: changed}, nil
+}
+
+// picturesChanged rewrites the manifests of the albums holding the given pictures and notifies clients.
+func (s *TagService) picturesChanged(pictureIDs []uint) {
+	albumIDs, err := s.pictureRepo.FindAlbumIDs(pictureIDs)
+	if err != nil {
+		slog.Warn("Service warning: failed to find albums for manifests", "error", err)
+		return
+	}
+	refreshManifests(s.hierarchyRepo, albumIDs...)
+	s.broker.Publish(events.PicturesUpdated, PicturesChanged{PictureIDs: pictureIDs, AlbumIDs: albumIDs})
+}
+
+// resolveTagRequest checks that the tag ids and pictures exist and returns the picture ids,
+// expanded to whole shots when requested.
+func (s *TagService) resolveTagRequest(req TagRequest, verr *ValidationError) ([]uint, error) {
+	if len(req.TagIDs) > 0 {
+		tags, err := s.repo.FindByIDs(req.TagIDs)
+		if err != nil {
+			return nil, err
+		}
+		if missing := missingIDs(req.TagIDs, tags, func(t model.Tag) uint { return t.ID }); len(missing) > 0 {
+			verr.add("tag_ids", CodeNotFound, fmt.Sprintf("tags %v do not exist", missing))
+		}
+	}
+
+	if len(req.PictureIDs) == 0 {
+		verr.add("picture_ids", CodeRequired, "give at least one picture id")
+		return nil, nil
+	}
+
+	pictures, err := s.pictureRepo.FindByIDs(req.PictureIDs)
+	if err != nil {
+		return nil, err
+	}
+	if missing := missingIDs(req.PictureIDs, pictures, func(p model.Picture) uint { return p.ID }); len(missing) > 0 {
+		verr.add("picture_ids", CodeNotFound, fmt.Sprintf("pictures %v do not exist", missing))
+		return nil, nil
+	}
+
+	if !req.Shots {
+		return req.PictureIDs, nil
+	}
+
+	return s.pictureRepo.ExpandShots(req.PictureIDs)
+}
+
+// splitTagPath trims every level of a tag path and checks it can be stored.
+func splitTagPath(field, path string) ([]string, *FieldError) {
+	parts := strings.Split(path, model.TagSeparator)
+	names := make([]string, 0, len(parts))
+
+	for _, part := range parts {
+		name := strings.TrimSpace(part)
+		if name == "" {
+			return nil, &FieldError{Field: field, Code: CodeInvalid, Message: fmt.Sprintf("tag path %q has an empty level", path)}
+		}
+		if strings.ContainsAny(name, "*?") {
+			// Searches treat both as wildcards, so tag:Event* would match more than this tag
+			return nil, &FieldError{Field: field, Code: CodeInvalid, Message: "tag names must not contain * or ?"}
+		}
+		if utf8.RuneCountInString(name) > maxTagNameLength {
+			return nil, &FieldError{Field: field, Code: CodeTooLong, Message: fmt.Sprintf("tag names must be at most %d characters", maxTagNameLength)}
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// missingIDs lists the requested ids that have no matching row.
+func missingIDs[T any](want []uint, found []T, id func(T) uint) []uint {
+	seen := make(map[uint]bool, len(found))
+	for _, f := range found {
+		seen[id(f)] = true
+	}
+
+	var missing []uint
+	for _, w := range want {
+		if !seen[w] {
+			missing = append(missing, w)
+		}
+	}
+	return missing
+}
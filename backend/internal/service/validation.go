@@ -0,0 +1,409 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/search"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// Limits matching the sizes of the hierarchies and album_attributes columns.
+const (
+	maxNodeNameLength     = 255
+	maxDetailLength       = 255
+	maxAttributeKeyLength = 100
+)
+
+// Field error codes returned to clients.
+const (
+	CodeRequired   = "required"
+	CodeTooLong    = "too_long"
+	CodeInvalid    = "invalid"
+	CodeUnknown    = "unknown"
+	CodeNotFound   = "not_found"
+	CodeNotFolder  = "not_a_folder"
+	CodeCycle      = "cycle"
+	CodeNotAllowed = "not_allowed"
+	CodeDuplicate  = "duplicate"
+)
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every field error of a rejected request.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.Field, f.Message))
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Conflict reports whether the request only failed because of duplicate names.
+func (e *ValidationError) Conflict() bool {
+	for _, f := range e.Fields {
+		if f.Code != CodeDuplicate {
+			return false
+		}
+	}
+	return len(e.Fields) > 0
+}
+
+func (e *ValidationError) add(field, code, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+func (e *ValidationError) addField(fe *FieldError) {
+	if fe != nil {
+		e.Fields = append(e.Fields, *fe)
+	}
+}
+
+// orNil returns the error only when at least one field failed.
+func (e *ValidationError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// reservedNames cannot be used as file names on Windows, where the library usually lives.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// validateNodeName checks that an already trimmed name is usable as a file or folder name.
+func validateNodeName(name string) *FieldError {
+	if name == "" {
+		return &FieldError{Field: "name", Code: CodeRequired, Message: "name must not be empty"}
+	}
+
+	if utf8.RuneCountInString(name) > maxNodeNameLength {
+		return &FieldError{Field: "name", Code: CodeTooLong, Message: fmt.Sprintf("name must be at most %d characters", maxNodeNameLength)}
+	}
+
+	for _, r := range name {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return &FieldError{Field: "name", Code: CodeInvalid, Message: fmt.Sprintf("name must not contain %q", r)}
+		}
+	}
+
+	if strings.HasSuffix(name, ".") {
+		return &FieldError{Field: "name", Code: CodeInvalid, Message: "name must not end with a dot"}
+	}
+
+	base := strings.ToUpper(strings.SplitN(name, ".", 2)[0])
+	if reservedNames[base] {
+		return &FieldError{Field: "name", Code: CodeInvalid, Message: fmt.Sprintf("%s is a reserved name", base)}
+	}
+
+	return nil
+}
+
+// validateNodeType accepts the known hierarchy node types.
+func validateNodeType(t model.HierarchyType) *FieldError {
+	switch t {
+	case model.TypeFolder, model.TypeAlbum, model.TypeSmart:
+		return nil
+	case "":
+		return &FieldError{Field: "type", Code: CodeRequired, Message: "type must not be empty"}
+	default:
+		return &FieldError{Field: "type", Code: CodeUnknown, Message: fmt.Sprintf("type must be folder, album or smart, got %q", t)}
+	}
+}
+
+// validateSortMode accepts the known folder sort modes.
+func validateSortMode(field string, mode model.SortMode) *FieldError {
+	switch mode {
+	case model.SortManual, model.SortName, model.SortCreated, model.SortFirstPicture:
+		return nil
+	default:
+		return &FieldError{Field: field, Code: CodeUnknown, Message: fmt.Sprintf("sort mode must be manual, name, created or first_picture, got %q", mode)}
+	}
+}
+
+// validateParent checks that parentID is an existing folder. When nodeID is set the parent must
+// also not be that node or one of its descendants.
+func (s *HierarchyService) validateParent(nodeID, parentID uint) (*FieldError, error) {
+	parent, err := s.repo.FindByID(parentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &FieldError{Field: "parent_id", Code: CodeNotFound, Message: fmt.Sprintf("parent %d does not exist", parentID)}, nil
+		}
+		return nil, err
+	}
+
+	if parent.Type != model.TypeFolder {
+		return &FieldError{Field: "parent_id", Code: CodeNotFolder, Message: "only folders can contain other nodes"}, nil
+	}
+
+	if nodeID == 0 {
+		return nil, nil
+	}
+
+	// Walk up from the new parent; meeting the node itself means the move would create a cycle
+	for current := parent; ; {
+		if current.ID == nodeID {
+			return &FieldError{Field: "parent_id", Code: CodeCycle, Message: "a node cannot be moved into itself or one of its descendants"}, nil
+		}
+
+		if current.ParentID == nil {
+			return nil, nil
+		}
+
+		current, err = s.repo.FindByID(*current.ParentID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+}
+
+// validateUnique rejects a name that a sibling of the same type already uses.
+func (s *HierarchyService) validateUnique(parentID *uint, name string, nodeType model.HierarchyType, excludeID uint) (*FieldError, error) {
+	exists, err := s.repo.FindDuplicate(parentID, name, nodeType, excludeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return &FieldError{Field: "name", Code: CodeDuplicate, Message: fmt.Sprintf("another %s named %q already exists here", nodeType, name)}, nil
+	}
+
+	return nil, nil
+}
+
+// validateCover checks that a picture can be the cover of an album. 0 clears the cover.
+func (s *HierarchyService) validateCover(node *model.Hierarchy, pictureID uint) (*FieldError, error) {
+	if node.Type != model.TypeAlbum {
+		return &FieldError{Field: "cover_picture_id", Code: CodeNotAllowed, Message: "only albums have a cover picture"}, nil
+	}
+
+	if pictureID == 0 {
+		return nil, nil
+	}
+
+	picture, err := s.pictureRepo.FindByID(pictureID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &FieldError{Field: "cover_picture_id", Code: CodeNotFound, Message: fmt.Sprintf("picture %d does not exist", pictureID)}, nil
+		}
+		return nil, err
+	}
+
+	if picture.SubFolder.HierarchyID != node.ID {
+		return &FieldError{Field: "cover_picture_id", Code: CodeInvalid, Message: "the cover must be a picture of this album"}, nil
+	}
+
+	return nil, nil
+}
+
+// applyAlbumDetails copies the album detail fields of an update onto the node, recording
+// field errors in verr. It returns the attributes to set and the keys to remove.
+func applyAlbumDetails(node *model.Hierarchy, req UpdateNodeRequest, verr *ValidationError) (map[string]string, []string) {
+	texts := []struct {
+		field string
+		value *string
+		dest  *string
+		limit int
+	}{
+		{"description", req.Description, &node.Description, 0},
+		{"location", req.Location, &node.Location, maxDetailLength},
+		{"client", req.Client, &node.Client, maxDetailLength},
+		{"contact", req.Contact, &node.Contact, maxDetailLength},
+	}
+
+	dates := []struct {
+		field string
+		value *string
+		dest  **time.Time
+	}{
+		{"event_start", req.EventStart, &node.EventStart},
+		{"event_end", req.EventEnd, &node.EventEnd},
+	}
+
+	touched := req.Attributes != nil
+	for _, t := range texts {
+		touched = touched || t.value != nil
+	}
+	for _, d := range dates {
+		touched = touched || d.value != nil
+	}
+
+	if !touched {
+		return nil, nil
+	}
+
+	if node.Type != model.TypeAlbum {
+		verr.add("album", CodeNotAllowed, "only albums have a description, event, location, client or attributes")
+		return nil, nil
+	}
+
+	for _, t := range texts {
+		if t.value == nil {
+			continue
+		}
+		value := strings.TrimSpace(*t.value)
+		if t.limit > 0 && utf8.RuneCountInString(value) > t.limit {
+			verr.add(t.field, CodeTooLong, fmt.Sprintf("%s must be at most %d characters", t.field, t.limit))
+			continue
+		}
+		*t.dest = value
+	}
+
+	for _, d := range dates {
+		if d.value == nil {
+			continue
+		}
+		date, err := parseEventDate(*d.value)
+		if err != nil {
+			verr.add(d.field, CodeInvalid, fmt.Sprintf("%s must look like 2025-06-14 or 2025-06-14T15:04:05Z", d.field))
+			continue
+		}
+		*d.dest = date
+	}
+
+	if node.EventStart != nil && node.EventEnd != nil && node.EventEnd.Before(*node.EventStart) {
+		verr.add("event_end", CodeInvalid, "event_end must not be before event_start")
+	}
+
+	set := make(map[string]string)
+	var remove []string
+	for key, value := range req.Attributes {
+		key = strings.TrimSpace(key)
+		switch {
+		case key == "":
+			verr.add("attributes", CodeRequired, "attribute keys must not be empty")
+		case utf8.RuneCountInString(key) > maxAttributeKeyLength:
+			verr.add("attributes", CodeTooLong, fmt.Sprintf("attribute key %q must be at most %d characters", key, maxAttributeKeyLength))
+		case value == nil:
+			remove = append(remove, key)
+		default:
+			set[key] = *value
+		}
+	}
+
+	return set, remove
+}
+
+// parseEventDate accepts a calendar day in local time or a full RFC 3339 timestamp. An empty value clears the date.
+func parseEventDate(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// validateSubFolderName checks a subfolder name with the node name rules, reporting it under field.
+func validateSubFolderName(field, name string) *FieldError {
+	fe := validateNodeName(name)
+	if fe != nil {
+		fe.Field = field
+		fe.Message = strings.Replace(fe.Message, "name", "subfolder name", 1)
+	}
+	return fe
+}
+
+// validateCreateNode applies every creation rule and returns a *ValidationError listing the failed fields.
+func (s *HierarchyService) validateCreateNode(req CreateNodeRequest) error {
+	verr := &ValidationError{}
+
+	verr.addField(validateNodeName(req.Name))
+	verr.addField(validateNodeType(req.Type))
+
+	if req.ParentID != 0 {
+		fe, err := s.validateParent(0, req.ParentID)
+		if err != nil {
+			return err
+		}
+		verr.addField(fe)
+	}
+
+	if req.Type == model.TypeSmart {
+		if strings.TrimSpace(req.Query) == "" {
+			verr.add("query", CodeRequired, "a smart album needs a search query")
+		} else if _, err := search.Parse(req.Query); err != nil {
+			verr.add("query", CodeInvalid, err.Error())
+		}
+	} else if req.Query != "" {
+		verr.add("query", CodeNotAllowed, "only smart albums have a search query")
+	}
+
+	if req.Type == model.TypeAlbum {
+		settings, err := s.settingsRepo.GetSettings()
+		if err != nil {
+			return err
+		}
+
+		folders, fe := resolveSubFolders(settings, req)
+		verr.addField(fe)
+
+		for i, sub := range req.SubFolders {
+			verr.addField(validateSubFolderName(fmt.Sprintf("sub_folders[%d].name", i), strings.TrimSpace(sub.Name)))
+		}
+
+		// Imports sort files into RAWs and JPGs
+		if fe == nil && req.SourcePath != "" && (!containsFold(folders, rawFolder) || !containsFold(folders, jpgFolder)) {
+			verr.add("template", CodeInvalid, fmt.Sprintf("importing needs the %s and %s subfolders", rawFolder, jpgFolder))
+		}
+	} else {
+		if req.Template != "" {
+			verr.add("template", CodeNotAllowed, "only albums have subfolders")
+		}
+		if len(req.SubFolders) > 0 {
+			verr.add("sub_folders", CodeNotAllowed, "only albums have subfolders")
+		}
+	}
+
+	if req.SourcePath != "" {
+		if req.Type != model.TypeAlbum {
+			verr.add("source_path", CodeNotAllowed, "only albums can import pictures")
+		} else if info, err := os.Stat(req.SourcePath); err != nil || !info.IsDir() {
+			verr.add("source_path", CodeNotFound, "source path is not an existing directory")
+		}
+	}
+
+	// Only look for duplicates once the name, type and parent are known to be valid
+	if len(verr.Fields) == 0 {
+		var parentID *uint
+		if req.ParentID != 0 {
+			parentID = &req.ParentID
+		}
+
+		fe, err := s.validateUnique(parentID, req.Name, req.Type, 0)
+		if err != nil {
+			return err
+		}
+		verr.addField(fe)
+	}
+
+	return verr.orNil()
+}
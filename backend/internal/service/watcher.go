@@ -0,0 +1,342 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"picturebot-backend/internal/events"
+	"picturebot-backend/internal/model"
+	"picturebot-backend/internal/repository"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gorm.io/gorm"
+)
+
+const (
+	watchDebounce      = 2 * time.Second        // Quiet time before a changed file is processed
+	watchFlushInterval = 500 * time.Millisecond // How often settled changes are processed
+	watchSyncInterval  = 30 * time.Second       // How often the watches follow the settings and new albums
+)
+
+// ownChanges holds the paths the app itself is moving or writing. The watcher leaves them alone
+// until the catalog has caught up, so a move is never mistaken for a new file.
+var ownChanges = &busyPaths{paths: make(map[string]int)}
+
+type busyPaths struct {
+	mu    sync.Mutex
+	paths map[string]int
+}
+
+// hold marks the paths busy until the returned function is called.
+func (b *busyPaths) hold(paths ...string) func() {
+	cleaned := make([]string, len(paths))
+	b.mu.Lock()
+	for i, p := range paths {
+		cleaned[i] = filepath.Clean(p)
+		b.paths[cleaned[i]]++
+	}
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for _, p := range cleaned {
+			if b.paths[p]--; b.paths[p] <= 0 {
+				delete(b.paths, p)
+			}
+		}
+	}
+}
+
+func (b *busyPaths) busy(path string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.paths[path] > 0
+}
+
+// WatcherService keeps the catalog in sync with files other programs add, change, rename or delete
+// in album subfolders. Only the subfolder directories themselves are watched, not directories below them.
+type WatcherService struct {
+	library       *LibraryService
+	subFolderRepo *repository.SubFolderRepository
+	pictureRepo   *repository.PictureRepository
+	settingsRepo  *repository.SettingsRepository
+	broker        *events.Broker
+
+	watcher *fsnotify.Watcher
+	watched map[string]model.SubFolder // Watched directories by cleaned location
+	pending map[string]time.Time       // Changed paths and the time of their last event
+}
+
+func NewWatcherService(library *LibraryService, subFolderRepo *repository.SubFolderRepository, pictureRepo *repository.PictureRepository, settingsRepo *repository.SettingsRepository, broker *events.Broker) *WatcherService {
+	return &WatcherService{
+		library:       library,
+		subFolderRepo: subFolderRepo,
+		pictureRepo:   pictureRepo,
+		settingsRepo:  settingsRepo,
+		broker:        broker,
+		watched:       make(map[string]model.SubFolder),
+		pending:       make(map[string]time.Time),
+	}
+}
+
+// RenamedPicture is the data of a picture.renamed event.
+type RenamedPicture struct {
+	Picture *model.Picture `json:"picture"`
+	From    string         `json:"from"`
+}
+
+// Run watches the album subfolders until ctx is cancelled. Nothing is watched while the
+// watch_albums setting is off; the setting is re-read on every sync.
+func (s *WatcherService) Run(ctx context.Context) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	s.watcher = w
+
+	s.sync()
+
+	syncTicker := time.NewTicker(watchSyncInterval)
+	defer syncTicker.Stop()
+	flushTicker := time.NewTicker(watchFlushInterval)
+	defer flushTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			s.queue(ev)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("IO warning: album watcher error", "error", err)
+		case now := <-flushTicker.C:
+			s.flush(now)
+		case <-syncTicker.C:
+			s.sync()
+		}
+	}
+}
+
+// sync adds watches for new subfolders and drops the ones whose subfolder is gone.
+func (s *WatcherService) sync() {
+	settings, err := s.settingsRepo.GetSettings()
+	if err != nil {
+		slog.Error("Service error: failed to load settings for the album watcher", "error", err)
+		return
+	}
+
+	wanted := make(map[string]model.SubFolder)
+	if settings.WatchAlbums {
+		subFolders, err := s.subFolderRepo.FindAll()
+		if err != nil {
+			slog.Error("Service error: failed to load subfolders to watch", "error", err)
+			return
+		}
+		for _, sf := range subFolders {
+			if sf.Location != "" {
+				wanted[filepath.Clean(sf.Location)] = sf
+			}
+		}
+	}
+
+	for dir := range s.watched {
+		if _, ok := wanted[dir]; !ok {
+			// The directory may be gone already, which removes the watch as well
+			_ = s.watcher.Remove(dir)
+			delete(s.watched, dir)
+		}
+	}
+
+	added := 0
+	for dir, sf := range wanted {
+		if _, ok := s.watched[dir]; !ok {
+			if err := s.watcher.Add(dir); err != nil {
+				slog.Debug("Album watcher skipped directory", "path", dir, "error", err)
+				continue
+			}
+			added++
+		}
+		s.watched[dir] = sf
+	}
+
+	if !settings.WatchAlbums {
+		clear(s.pending)
+	}
+
+	if added > 0 {
+		slog.Info("Album watcher updated", "directories", len(s.watched), "added", added)
+	}
+}
+
+// queue records a change, postponing it until the path has been quiet for watchDebounce.
+func (s *WatcherService) queue(ev fsnotify.Event) {
+	if ev.Op == fsnotify.Chmod || ignoredByWatcher(filepath.Base(ev.Name)) {
+		return
+	}
+	s.pending[filepath.Clean(ev.Name)] = time.Now()
+}
+
+// ignoredByWatcher skips the album manifest and the temporary files editors write before saving.
+func ignoredByWatcher(name string) bool {
+	return name == manifestFile ||
+		strings.HasPrefix(name, ".") ||
+		strings.HasPrefix(name, "~") ||
+		strings.HasSuffix(strings.ToLower(name), ".tmp")
+}
+
+// flush processes the paths that settled. Deletions go first so a rename within the same
+// batch finds the picture it belongs to already marked missing. Paths the app is still moving
+// wait until the move is committed, after which they match their picture rows.
+func (s *WatcherService) flush(now time.Time) {
+	var gone, present []string
+	for path, last := range s.pending {
+		if now.Sub(last) < watchDebounce {
+			continue
+		}
+		if ownChanges.busy(path) {
+			s.pending[path] = now
+			continue
+		}
+		delete(s.pending, path)
+
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			gone = append(gone, path)
+		} else {
+			present = append(present, path)
+		}
+	}
+
+	sort.Strings(gone)
+	sort.Strings(present)
+
+	for _, path := range gone {
+		if err := s.fileRemoved(path); err != nil {
+			slog.Error("Service error: album watcher failed to record a deleted file", "path", path, "error", err)
+		}
+	}
+	for _, path := range present {
+		if err := s.fileChanged(path); err != nil {
+			slog.Error("Service error: album watcher failed to register a file", "path", path, "error", err)
+		}
+	}
+}
+
+// fileRemoved marks the picture stored at path as missing. Its ratings and tags are kept,
+// so restoring or renaming the file links it up again.
+func (s *WatcherService) fileRemoved(path string) error {
+	picture, err := s.pictureRepo.FindByLocation(path)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if picture.MissingAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if err := s.pictureRepo.MarkMissing(picture.ID, now); err != nil {
+		return err
+	}
+	picture.MissingAt = &now
+
+	slog.Warn("Picture file deleted outside the app", "id", picture.ID, "path", path)
+	s.broker.Publish(events.PictureMissing, picture)
+	return nil
+}
+
+// fileChanged registers a new or modified file. Unknown files matching a missing picture of the
+// same album by content are treated as a rename, other unknown files are imported.
+func (s *WatcherService) fileChanged(path string) error {
+	sub, ok := s.watched[filepath.Dir(path)]
+	if !ok {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+
+	hash, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+
+	picture, err := s.pictureRepo.FindByLocation(path)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if picture != nil {
+		// Our own moves and imports end up here with nothing changed
+		if picture.Hash == hash && picture.Size == info.Size() && picture.MissingAt == nil {
+			return nil
+		}
+		if err := s.pictureRepo.UpdateChecksum(picture.ID, info.Size(), hash); err != nil {
+			return err
+		}
+
+		slog.Info("Picture file changed outside the app", "id", picture.ID, "path", path)
+		return s.publishPicture(events.PictureUpdated, picture.ID, sub.HierarchyID)
+	}
+
+	candidates, err := s.pictureRepo.FindMissingByHash(sub.HierarchyID, hash)
+	if err != nil {
+		return err
+	}
+
+	if len(candidates) > 0 {
+		renamed := candidates[0]
+		from := renamed.Location
+
+		renamed.FileName = filepath.Base(path)
+		renamed.Extension = filepath.Ext(path)
+		renamed.Location = path
+		renamed.SubFolderID = sub.ID
+		renamed.MissingAt = nil
+		if err := s.pictureRepo.UpdateFiles([]*model.Picture{&renamed}); err != nil {
+			return err
+		}
+
+		slog.Info("Picture file renamed outside the app", "id", renamed.ID, "from", from, "to", path)
+		refreshManifests(s.library.hierarchyRepo, sub.HierarchyID)
+		s.broker.Publish(events.PictureRenamed, RenamedPicture{Picture: &renamed, From: from})
+		return nil
+	}
+
+	added, err := s.library.importFile(&sub, path)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Picture file added outside the app", "id", added.ID, "path", added.Location)
+	return s.publishPicture(events.PictureAdded, added.ID, sub.HierarchyID)
+}
+
+// publishPicture reloads a picture with its details, refreshes its album's manifest and publishes the event.
+func (s *WatcherService) publishPicture(eventType string, id, albumID uint) error {
+	picture, err := s.pictureRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	refreshManifests(s.library.hierarchyRepo, albumID)
+	s.broker.Publish(eventType, picture)
+	return nil
+}
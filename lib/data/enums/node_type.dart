@@ -1,4 +1,5 @@
 enum NodeType {
   folder,
   album,
+  smart,
 }
@@ -1,13 +1,33 @@
 import 'package:equatable/equatable.dart';
 import 'package:flutter/material.dart';
 
+/// Mirrors the backend settings. The backend only changes the settings a save
+/// sends, so [toJson] holds just the ones the app edits; the others are only
+/// read and keep their stored value, even when the server changed them since
+/// they were loaded (e.g. reordering switches the root to manual sorting).
 class Settings extends Equatable {
   final ThemeMode themeMode;
   final String libraryPath;
+  final String rootSortMode;
+  final String defaultTemplate;
+  final int scrubIntervalDays;
+  final int scrubRateMb;
+  final bool watchAlbums;
+  final String backupDir;
+  final int backupIntervalHours;
+  final int backupKeep;
 
   const Settings({
     required this.themeMode,
     required this.libraryPath,
+    this.rootSortMode = 'name',
+    this.defaultTemplate = '',
+    this.scrubIntervalDays = 30,
+    this.scrubRateMb = 20,
+    this.watchAlbums = false,
+    this.backupDir = '',
+    this.backupIntervalHours = 24,
+    this.backupKeep = 7,
   });
 
   factory Settings.initial() {
@@ -20,10 +40,26 @@ class Settings extends Equatable {
   Settings copyWith({
     ThemeMode? themeMode,
     String? libraryPath,
+    String? rootSortMode,
+    String? defaultTemplate,
+    int? scrubIntervalDays,
+    int? scrubRateMb,
+    bool? watchAlbums,
+    String? backupDir,
+    int? backupIntervalHours,
+    int? backupKeep,
   }) {
     return Settings(
       themeMode: themeMode ?? this.themeMode,
       libraryPath: libraryPath ?? this.libraryPath,
+      rootSortMode: rootSortMode ?? this.rootSortMode,
+      defaultTemplate: defaultTemplate ?? this.defaultTemplate,
+      scrubIntervalDays: scrubIntervalDays ?? this.scrubIntervalDays,
+      scrubRateMb: scrubRateMb ?? this.scrubRateMb,
+      watchAlbums: watchAlbums ?? this.watchAlbums,
+      backupDir: backupDir ?? this.backupDir,
+      backupIntervalHours: backupIntervalHours ?? this.backupIntervalHours,
+      backupKeep: backupKeep ?? this.backupKeep,
     );
   }
 
@@ -31,6 +67,14 @@ class Settings extends Equatable {
     return Settings(
       themeMode: _parseThemeMode(json['theme_mode']),
       libraryPath: json['library_path'] ?? '',
+      rootSortMode: json['root_sort_mode'] ?? 'name',
+      defaultTemplate: json['default_template'] ?? '',
+      scrubIntervalDays: json['scrub_interval_days'] ?? 30,
+      scrubRateMb: json['scrub_rate_mb'] ?? 20,
+      watchAlbums: json['watch_albums'] ?? false,
+      backupDir: json['backup_dir'] ?? '',
+      backupIntervalHours: json['backup_interval_hours'] ?? 24,
+      backupKeep: json['backup_keep'] ?? 7,
     );
   }
 
@@ -54,5 +98,16 @@ class Settings extends Equatable {
   }
 
   @override
-  List<Object?> get props => [themeMode, libraryPath];
+  List<Object?> get props => [
+        themeMode,
+        libraryPath,
+        rootSortMode,
+        defaultTemplate,
+        scrubIntervalDays,
+        scrubRateMb,
+        watchAlbums,
+        backupDir,
+        backupIntervalHours,
+        backupKeep,
+      ];
 }